@@ -0,0 +1,32 @@
+// Package admin builds the server exposing reflection and channelz, which is
+// kept apart from the public port.
+package admin
+
+import (
+	"fmt"
+
+	"github.com/jamiewhitney/grpc-go-vault/middleware"
+	"google.golang.org/grpc"
+	grpcadmin "google.golang.org/grpc/admin"
+	"google.golang.org/grpc/reflection"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+)
+
+// NewServer returns a server for the admin services, admitting only calls
+// presenting token as their bearer token. Reflection describes the services
+// of main rather than the admin server's own, so that they can be explored
+// without reaching the public port. The returned function releases the
+// resources of the admin services.
+func NewServer(token string, main reflection.ServiceInfoProvider, opts ...grpc.ServerOption) (*grpc.Server, func(), error) {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(middleware.UnaryBearerToken(token)),
+		grpc.ChainStreamInterceptor(middleware.StreamBearerToken(token)),
+	)
+	s := grpc.NewServer(opts...)
+	cleanup, err := grpcadmin.Register(s)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to register admin services: %w", err)
+	}
+	rpb.RegisterServerReflectionServer(s, reflection.NewServer(reflection.ServerOptions{Services: main}))
+	return s, cleanup, nil
+}
@@ -0,0 +1,62 @@
+package admin
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/jamiewhitney/grpc-go-vault/hello/v1"
+	"github.com/jamiewhitney/grpc-go-vault/internal/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+func listServices(ctx context.Context, c rpb.ServerReflectionClient) ([]string, error) {
+	stream, err := c.ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(&rpb.ServerReflectionRequest{MessageRequest: &rpb.ServerReflectionRequest_ListServices{}}); err != nil {
+		return nil, err
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, service := range resp.GetListServicesResponse().GetService() {
+		names = append(names, service.GetName())
+	}
+	return names, nil
+}
+
+func TestNewServer(t *testing.T) {
+	main := grpc.NewServer()
+	pb.RegisterHelloServiceServer(main, &testutil.HelloServer{})
+
+	s, cleanup, err := NewServer("s3cret", main)
+	if err != nil {
+		t.Fatalf("NewServer() got unexpected error: %v", err)
+	}
+	t.Cleanup(cleanup)
+	c := rpb.NewServerReflectionClient(testutil.Dial(t, s))
+
+	if _, err := listServices(context.Background(), c); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("ListServices() without token got error %v, wanted code %s", err, codes.Unauthenticated)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer s3cret")
+	names, err := listServices(ctx, c)
+	if err != nil {
+		t.Fatalf("ListServices() got unexpected error: %v", err)
+	}
+	found := false
+	for _, name := range names {
+		found = found || name == pb.HelloService_ServiceDesc.ServiceName
+	}
+	if !found {
+		t.Errorf("ListServices() got %v, wanted %s among them", names, pb.HelloService_ServiceDesc.ServiceName)
+	}
+}
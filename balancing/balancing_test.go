@@ -0,0 +1,94 @@
+package balancing
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+type fakeSubConn struct {
+	balancer.SubConn
+}
+
+func TestLeastRequestPicker(t *testing.T) {
+	a, b := &fakeSubConn{}, &fakeSubConn{}
+	picker := (&leastRequestPickerBuilder{}).Build(base.PickerBuildInfo{
+		ReadySCs: map[balancer.SubConn]base.SubConnInfo{a: {}, b: {}},
+	})
+
+	// Calls that never finish should still be shared out evenly.
+	picks := map[balancer.SubConn]int{}
+	for i := 0; i < 100; i++ {
+		res, err := picker.Pick(balancer.PickInfo{})
+		if err != nil {
+			t.Fatalf("Pick() got unexpected error: %v", err)
+		}
+		picks[res.SubConn]++
+	}
+	if picks[a] < 40 || picks[b] < 40 {
+		t.Errorf("Pick() got %d and %d picks, wanted an even split", picks[a], picks[b])
+	}
+
+	// Finished calls no longer count against their connection.
+	for _, conn := range picker.(*leastRequestPicker).conns {
+		atomic.StoreInt32(&conn.inFlight, 0)
+	}
+	res, _ := picker.Pick(balancer.PickInfo{})
+	res.Done(balancer.DoneInfo{})
+	for _, conn := range picker.(*leastRequestPicker).conns {
+		if got := atomic.LoadInt32(&conn.inFlight); got != 0 {
+			t.Errorf("Done() left %d calls in flight, wanted 0", got)
+		}
+	}
+}
+
+func TestLeastRequestPickerNoConns(t *testing.T) {
+	picker := (&leastRequestPickerBuilder{}).Build(base.PickerBuildInfo{})
+	if _, err := picker.Pick(balancer.PickInfo{}); err != balancer.ErrNoSubConnAvailable {
+		t.Errorf("Pick() got error %v, wanted %v", err, balancer.ErrNoSubConnAvailable)
+	}
+}
+
+type countingResolver struct {
+	resolves int32
+	closed   int32
+}
+
+func (r *countingResolver) ResolveNow(resolver.ResolveNowOptions) { atomic.AddInt32(&r.resolves, 1) }
+func (r *countingResolver) Close()                                { atomic.StoreInt32(&r.closed, 1) }
+
+type countingBuilder struct {
+	resolver.Builder
+	r *countingResolver
+}
+
+func (b *countingBuilder) Build(resolver.Target, resolver.ClientConn, resolver.BuildOptions) (resolver.Resolver, error) {
+	return b.r, nil
+}
+
+func TestPeriodicResolver(t *testing.T) {
+	counting := &countingResolver{}
+	builder := &periodicBuilder{Builder: &countingBuilder{r: counting}, interval: 10 * time.Millisecond}
+
+	r, err := builder.Build(resolver.Target{}, nil, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatalf("Build() got unexpected error: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&counting.resolves) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := atomic.LoadInt32(&counting.resolves); got < 2 {
+		t.Errorf("resolver re-resolved %d times, wanted at least 2", got)
+	}
+
+	r.Close()
+	if atomic.LoadInt32(&counting.closed) != 1 {
+		t.Errorf("Close() did not close the wrapped resolver")
+	}
+}
@@ -0,0 +1,68 @@
+// Package balancing spreads client calls across every server behind a DNS
+// name: a resolver that keeps re-resolving the name and a least-request
+// load balancing policy to complement gRPC's round_robin.
+package balancing
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+// LeastRequest is the name of the least-request load balancing policy, for
+// use in a service config's loadBalancingConfig.
+const LeastRequest = "least_request"
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(LeastRequest, &leastRequestPickerBuilder{}, base.Config{}))
+}
+
+type leastRequestPickerBuilder struct{}
+
+func (*leastRequestPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	p := &leastRequestPicker{rand: rand.New(rand.NewSource(rand.Int63()))}
+	for sc := range info.ReadySCs {
+		p.conns = append(p.conns, &leastRequestConn{sc: sc})
+	}
+	return p
+}
+
+// leastRequestPicker samples two ready connections at random and picks the
+// one with fewer calls in flight. Counts start from zero whenever the set of
+// ready connections changes, which only briefly skews the choice.
+type leastRequestPicker struct {
+	conns []*leastRequestConn
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+type leastRequestConn struct {
+	sc       balancer.SubConn
+	inFlight int32
+}
+
+func (p *leastRequestPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	p.mu.Lock()
+	a := p.conns[p.rand.Intn(len(p.conns))]
+	b := p.conns[p.rand.Intn(len(p.conns))]
+	p.mu.Unlock()
+
+	picked := a
+	if atomic.LoadInt32(&b.inFlight) < atomic.LoadInt32(&a.inFlight) {
+		picked = b
+	}
+	atomic.AddInt32(&picked.inFlight, 1)
+	return balancer.PickResult{
+		SubConn: picked.sc,
+		Done: func(balancer.DoneInfo) {
+			atomic.AddInt32(&picked.inFlight, -1)
+		},
+	}, nil
+}
@@ -0,0 +1,56 @@
+package balancing
+
+import (
+	"time"
+
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/dns"
+)
+
+// DNS returns a builder for dns:/// targets that re-resolves the name every
+// interval. gRPC's own DNS resolver only re-resolves when a connection
+// fails, so servers added behind a headless service would otherwise receive
+// no calls from clients already running. gRPC rate limits re-resolution to
+// once every 30 seconds, so shorter intervals have no further effect.
+func DNS(interval time.Duration) resolver.Builder {
+	return &periodicBuilder{Builder: dns.NewBuilder(), interval: interval}
+}
+
+type periodicBuilder struct {
+	resolver.Builder
+	interval time.Duration
+}
+
+func (b *periodicBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	r, err := b.Builder.Build(target, cc, opts)
+	if err != nil || b.interval <= 0 {
+		return r, err
+	}
+
+	p := &periodicResolver{Resolver: r, done: make(chan struct{})}
+	go p.run(b.interval)
+	return p, nil
+}
+
+type periodicResolver struct {
+	resolver.Resolver
+	done chan struct{}
+}
+
+func (r *periodicResolver) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.ResolveNow(resolver.ResolveNowOptions{})
+		}
+	}
+}
+
+func (r *periodicResolver) Close() {
+	close(r.done)
+	r.Resolver.Close()
+}
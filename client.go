@@ -2,101 +2,650 @@ package main
 
 import (
 	"context"
+	"crypto/x509"
+	"errors"
+	"flag"
 	"fmt"
-	"github.com/jamiewhitney/auth-jwt-grpc"
+	"log"
+	"net/url"
 	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/golang-jwt/jwt"
 	vault "github.com/hashicorp/vault/api"
 	"github.com/hashicorp/vault/sdk/helper/certutil"
-	pb "github.com/jamiewhitney/grpc-go-vault/hello"
+	"github.com/jamiewhitney/grpc-go-vault/balancing"
+	"github.com/jamiewhitney/grpc-go-vault/config"
+	_ "github.com/jamiewhitney/grpc-go-vault/hello" // registers the deprecated API for replay
+	pb "github.com/jamiewhitney/grpc-go-vault/hello/v1"
+	"github.com/jamiewhitney/grpc-go-vault/loadtest"
+	"github.com/jamiewhitney/grpc-go-vault/middleware"
+	"github.com/jamiewhitney/grpc-go-vault/output"
+	"github.com/jamiewhitney/grpc-go-vault/pki"
+	"github.com/jamiewhitney/grpc-go-vault/recording"
+	"github.com/jamiewhitney/grpc-go-vault/serviceconfig"
+	"github.com/jamiewhitney/grpc-go-vault/startup"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/oauth"
-	"log"
-	"time"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	_ "google.golang.org/grpc/xds" // registers the xds:/// resolver
 )
 
-type TokenReponse struct {
-	AccessToken string `json:"access_token"`
-	Scope       string `json:"scope"`
-	ExpiresIn   int    `json:"expires_in"`
-	TokenType   string `json:"token_type"`
+// command is one of the client's subcommands, named by one or two words such
+// as "hello" or "user create".
+type command struct {
+	usage string
+	run   func(ctx context.Context, s *session, args []string) error
 }
 
-type TokenRequest struct {
-	ClientId     string `json:"client_id"`
-	ClientSecret string `json:"client_secret"`
-	Audience     string `json:"audience"`
-	GrantType    string `json:"grant_type"`
+var commands = map[string]command{
+	"hello":       {"[-name NAME] [-count N] [-interval DURATION]", runHello},
+	"load":        {"[-mode closed|rate] [-stages DURATION:TARGET,...] [-think DURATION] [-max-in-flight N] [-name NAME]", runLoad},
+	"replay":      {"-file PATH [-speed FACTOR] [-max-in-flight N]", runReplay},
+	"user create": {"-id ID -name NAME", runUserCreate},
+	"user get":    {"-id ID", runUserGet},
+	"user list":   {"[-page-size N]", runUserList},
+	"cert show":   {"", runCertShow},
+	"token show":  {"[-raw]", runTokenShow},
 }
 
 func main() {
-	//vault
+	cfg, err := config.Load("client", os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		usage()
+		return
+	}
+	if err == nil {
+		err = cfg.ValidateClient()
+	}
+	if err != nil {
+		startup.Exit(log.Printf, startup.Config.Wrap(err))
+	}
 
-	vaultClient, err := vault.NewClient(&vault.Config{
-		Address: os.Getenv("VAULT_ADDR"),
-	})
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	name, cmd, args, ok := lookup(cfg.Args)
+	if !ok {
+		usage()
+		err := errors.New("no command given")
+		if len(cfg.Args) > 0 {
+			err = fmt.Errorf("unknown command %q", strings.Join(cfg.Args, " "))
+		}
+		startup.Exit(log.Printf, startup.Config.Wrap(err))
+	}
+
+	out, err := output.New(os.Stdout, cfg.Output)
 	if err != nil {
-		fmt.Printf("failed to create vault client: %v", err)
+		startup.Exit(log.Printf, startup.Config.Wrap(err))
 	}
+	s := &session{cfg: cfg, out: out}
+	err = cmd.run(ctx, s, args)
+	s.close()
 
-	vaultClient.SetToken("root")
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		// Failed calls are reported with their error details and exit 1,
+		// leaving the other exit codes to setup failures.
+		if _, ok := status.FromError(err); ok {
+			logStatus(name, err)
+			os.Exit(1)
+		}
+		startup.Exit(log.Printf, err)
+	}
+}
 
-	secret, err := vaultClient.Logical().Write("grpc/issue/hello-service", map[string]interface{}{
-		"common_name": "grpc.example.com",
-		"alt_names":   "localhost",
-	})
+// lookup finds the command named by the first one or two of args, returning
+// the arguments that follow its name.
+func lookup(args []string) (string, command, []string, bool) {
+	for n := 2; n >= 1; n-- {
+		if len(args) < n {
+			continue
+		}
+		name := strings.Join(args[:n], " ")
+		if cmd, ok := commands[name]; ok {
+			return name, cmd, args[n:], true
+		}
+	}
+	return "", command{}, nil, false
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "Usage: client [flags] <command> [command flags]\n\nCommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", strings.TrimSpace(name+" "+commands[name].usage))
+	}
+}
+
+// parseFlags parses the flags of the named command.
+func parseFlags(name string, fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return startup.Config.Wrap(err)
+	}
+	if fs.NArg() > 0 {
+		return startup.Config.Wrap(fmt.Errorf("%s: unexpected arguments %q", name, fs.Args()))
+	}
+	return nil
+}
+
+// session sets up what commands need on first use, so that cert show, for
+// instance, neither fetches a token nor dials the server. The Vault and auth
+// settings are shared by every command.
+type session struct {
+	cfg *config.Config
+	out *output.Printer
+
+	vault  *vault.Client
+	cert   *pki.Certificate
+	tokens oauth2.TokenSource
+	app    *newrelic.Application
+	conn   *grpc.ClientConn
+}
+
+func (s *session) vaultClient(ctx context.Context) (*vault.Client, error) {
+	if s.vault == nil {
+		client, err := pki.Login(ctx, s.cfg.Vault)
+		if err != nil {
+			return nil, startup.VaultLogin.Wrap(err)
+		}
+		s.vault = client
+	}
+	return s.vault, nil
+}
+
+func (s *session) certificate(ctx context.Context) (*pki.Certificate, error) {
+	if s.cert == nil {
+		vaultClient, err := s.vaultClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := pki.Issue(ctx, vaultClient, s.cfg.Vault)
+		if err != nil {
+			return nil, startup.IssueCert.Wrap(err)
+		}
+		s.cert = cert
+	}
+	return s.cert, nil
+}
+
+func (s *session) tokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	if s.tokens == nil {
+		vaultClient, err := s.vaultClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		authTokenData, err := pki.ReadKV(ctx, vaultClient, s.cfg.Vault.Auth0Path)
+		if err != nil {
+			return nil, startup.FetchToken.Wrap(err)
+		}
+		tokens, err := tokenSource(ctx, authTokenData)
+		if err != nil {
+			return nil, startup.FetchToken.Wrap(err)
+		}
+		s.tokens = tokens
+	}
+	return s.tokens, nil
+}
+
+func (s *session) dial(ctx context.Context) (*grpc.ClientConn, error) {
+	if s.conn != nil {
+		return s.conn, nil
+	}
+	cfg := s.cfg
+
+	serviceConfig, err := serviceconfig.Load(cfg.ServiceConfig)
+	if err == nil {
+		serviceConfig, err = serviceconfig.WithLoadBalancing(serviceConfig, cfg.LoadBalancing)
+	}
 	if err != nil {
-		fmt.Printf("failed to create certificate: %v", err)
+		return nil, startup.Config.Wrap(err)
 	}
 
-	// tls credentials
+	// grpc-go does not act on hedgingPolicy, so hedge in an interceptor
+	hedging, err := serviceconfig.HedgingPolicies(serviceConfig)
+	if err != nil {
+		return nil, startup.Config.Wrap(err)
+	}
+	throttling, err := serviceconfig.RetryThrottling(serviceConfig)
+	if err != nil {
+		return nil, startup.Config.Wrap(err)
+	}
+
+	// telemetry is optional on the client, unlike on the server
+	if cfg.NewRelic.License != "" {
+		s.app, err = newrelic.NewApplication(
+			newrelic.ConfigAppName(cfg.NewRelic.AppName),
+			newrelic.ConfigLicense(cfg.NewRelic.License),
+		)
+		if err != nil {
+			return nil, startup.Telemetry.Wrap(err)
+		}
+	}
 
-	parsedCertBundle, err := certutil.ParsePKIMap(secret.Data)
+	cert, err := s.certificate(ctx)
 	if err != nil {
-		fmt.Errorf("Error parsing secret: %s", err)
+		return nil, err
 	}
 
-	tlsConfig, err := parsedCertBundle.GetTLSConfig(certutil.TLSClient)
+	// tls credentials
+	tlsConfig, err := cert.TLSConfig(certutil.TLSClient)
 	if err != nil {
-		fmt.Errorf("Could not get TLS config: %s", err)
+		return nil, startup.BuildTLS.Wrap(err)
 	}
 
+	// Targets such as dns:///grpc-server-headless:3000 name no host the
+	// certificate is issued for, so verify it against ServerName instead.
+	if cfg.ServerName != "" {
+		tlsConfig.ServerName = cfg.ServerName
+	}
 	tlsCredentials := credentials.NewTLS(tlsConfig)
 
 	// token
-	auth0ClientId, err := vaultClient.Logical().Read("hello-service/data/auth0")
+	tokens, err := s.tokenSource(ctx)
 	if err != nil {
-		fmt.Errorf("failed to retrieve token")
+		return nil, err
 	}
 
-	authTokenData := auth0ClientId.Data["data"].(map[string]interface{})
+	// grpc
+	perRPC := oauth.TokenSource{TokenSource: tokens}
+	breaker := middleware.NewCircuitBreaker(cfg.CircuitBreaker, s.app, log.Printf)
+	hedger := serviceconfig.NewHedger(hedging, throttling, s.app)
 
-	clientToken := authTokenData["id"].(string)
+	conn, err := grpc.Dial(cfg.TargetAddr,
+		grpc.WithTransportCredentials(tlsCredentials),
+		grpc.WithPerRPCCredentials(perRPC),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+		grpc.WithResolvers(balancing.DNS(cfg.ResolveInterval)),
+		grpc.WithChainUnaryInterceptor(middleware.UnaryClientRequestID(), middleware.UnaryClientDeadline(cfg.Deadlines), breaker.Unary(), hedger.Unary()),
+	)
+	if err != nil {
+		return nil, startup.Dial.Wrap(err)
+	}
+	s.conn = conn
+	return conn, nil
+}
 
-	clientSecret := authTokenData["secret"].(string)
+func (s *session) close() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.app.Shutdown(10 * time.Second)
+}
 
-	url := authTokenData["url"].(string)
+func runHello(ctx context.Context, s *session, args []string) error {
+	fs := flag.NewFlagSet("hello", flag.ContinueOnError)
+	name := fs.String("name", "Jamie", "name to greet")
+	count := fs.Int("count", 1, "number of calls to make, 0 to call until interrupted")
+	interval := fs.Duration("interval", time.Second, "time between calls")
+	if err := parseFlags("hello", fs, args); err != nil {
+		return err
+	}
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	client := pb.NewHelloServiceClient(conn)
 
-	audience := authTokenData["audience"].(string)
+	// Transient failures have already been retried according to the service
+	// config by the time a call returns, so when making several calls errors
+	// are logged and the next call made as usual. The command fails if the
+	// last call did.
+	var lastErr error
+	for i := 0; *count == 0 || i < *count; i++ {
+		if i > 0 {
+			wait := *interval
+			if delay, ok := retryDelay(lastErr); ok && delay > wait {
+				wait = delay
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(wait):
+			}
+		}
 
-	// grpc
-	perRPC := oauth.NewOauthAccess(auth.FetchToken(clientToken, clientSecret, url, audience, "client_credentials"))
+		response, err := client.SayHello(ctx, &pb.HelloRequest{Name: *name})
+		lastErr = err
+		if err != nil {
+			if *count == 0 || i < *count-1 {
+				logStatus("SayHello", err)
+			}
+			continue
+		}
+		if err := s.out.Print(response); err != nil {
+			return err
+		}
+	}
+	return lastErr
+}
 
-	conn, err := grpc.Dial(":3000", grpc.WithTransportCredentials(tlsCredentials), grpc.WithPerRPCCredentials(perRPC))
+// runLoad calls SayHello in stages, with the same credentials, interceptors
+// and service config as every other command, and reports how it went.
+func runLoad(ctx context.Context, s *session, args []string) error {
+	fs := flag.NewFlagSet("load", flag.ContinueOnError)
+	mode := fs.String("mode", loadtest.ClosedLoop, "closed for concurrent callers, rate for calls per second")
+	stages := fs.String("stages", "30s:10,1m:10,30s:0", "comma separated duration:target stages, the target ramping linearly over each")
+	think := fs.Duration("think", 0, "pause between a caller's calls in closed mode")
+	maxInFlight := fs.Int("max-in-flight", 1000, "calls in flight beyond which rate mode drops calls")
+	name := fs.String("name", "Jamie", "name to greet")
+	if err := parseFlags("load", fs, args); err != nil {
+		return err
+	}
+	parsed, err := loadtest.ParseStages(*stages)
 	if err != nil {
-		log.Fatalf("did not connect: %s", err)
+		return startup.Config.Wrap(err)
+	}
+	opts := loadtest.Options{
+		Mode:        *mode,
+		Stages:      parsed,
+		Think:       *think,
+		MaxInFlight: *maxInFlight,
+	}
+	if err := opts.Validate(); err != nil {
+		return startup.Config.Wrap(err)
 	}
-	defer conn.Close()
 
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
 	client := pb.NewHelloServiceClient(conn)
 
+	report, err := loadtest.Run(ctx, opts, func(ctx context.Context) error {
+		_, err := client.SayHello(ctx, &pb.HelloRequest{Name: *name})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return s.out.Print(report)
+}
+
+// runReplay replays calls recorded by a server with record set, with the
+// client's own credentials in place of the recorded callers'.
+func runReplay(ctx context.Context, s *session, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	file := fs.String("file", "", "JSON Lines recording to replay")
+	speed := fs.Float64("speed", 1, "factor to speed up the recorded pacing by, 0 to replay as fast as possible")
+	maxInFlight := fs.Int("max-in-flight", 1000, "calls in flight beyond which calls are dropped, or waited for at speed 0")
+	if err := parseFlags("replay", fs, args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return startup.Config.Wrap(errors.New("replay: -file is required"))
+	}
+	f, err := os.Open(*file)
+	if err != nil {
+		return startup.Config.Wrap(err)
+	}
+	defer f.Close()
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+
+	report, err := loadtest.RunReplay(ctx, recording.NewReader(f), *speed, *maxInFlight, func(ctx context.Context, entry *recording.Entry) error {
+		req, resp, err := entry.Messages()
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		for key, values := range entry.Metadata {
+			for _, v := range values {
+				ctx = metadata.AppendToOutgoingContext(ctx, key, v)
+			}
+		}
+		return conn.Invoke(ctx, entry.Method, req, resp)
+	})
+	if err != nil {
+		return startup.Config.Wrap(err)
+	}
+	return s.out.Print(report)
+}
+
+func runUserCreate(ctx context.Context, s *session, args []string) error {
+	fs := flag.NewFlagSet("user create", flag.ContinueOnError)
+	id := fs.String("id", "", "id of the user")
+	name := fs.String("name", "", "name of the user")
+	if err := parseFlags("user create", fs, args); err != nil {
+		return err
+	}
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	response, err := pb.NewCreateUserServiceClient(conn).CreateUser(ctx, &pb.CreateUserRequest{Id: *id, Name: *name})
+	if err != nil {
+		return err
+	}
+	return s.out.Print(response)
+}
+
+func runUserGet(ctx context.Context, s *session, args []string) error {
+	fs := flag.NewFlagSet("user get", flag.ContinueOnError)
+	id := fs.String("id", "", "id of the user")
+	if err := parseFlags("user get", fs, args); err != nil {
+		return err
+	}
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	user, err := pb.NewCreateUserServiceClient(conn).GetUser(ctx, &pb.GetUserRequest{Id: *id})
+	if err != nil {
+		return err
+	}
+	return s.out.Print(user)
+}
+
+// runUserList lists every user, requesting them a page at a time.
+func runUserList(ctx context.Context, s *session, args []string) error {
+	fs := flag.NewFlagSet("user list", flag.ContinueOnError)
+	pageSize := fs.Int("page-size", 0, "number of users to request at a time, 0 for the server's default")
+	if err := parseFlags("user list", fs, args); err != nil {
+		return err
+	}
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	client := pb.NewCreateUserServiceClient(conn)
+
+	all := &pb.ListUsersResponse{}
+	req := &pb.ListUsersRequest{PageSize: int32(*pageSize)}
 	for {
-		response, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "Jamie"})
+		page, err := client.ListUsers(ctx, req)
 		if err != nil {
-			log.Fatalf("error when calling SayHello: %s", err)
+			return err
+		}
+		all.Users = append(all.Users, page.GetUsers()...)
+		if page.GetNextPageToken() == "" {
+			break
 		}
-		log.Printf("Response from Server: %s", response.GetName())
-		time.Sleep(time.Duration(1) * time.Second)
+		req.PageToken = page.GetNextPageToken()
+	}
+	return s.out.Print(all)
+}
+
+// certificateInfo describes the certificate Vault issues the client.
+type certificateInfo struct {
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	Serial      string    `json:"serial"`
+	DNSNames    []string  `json:"dns_names"`
+	IPAddresses []string  `json:"ip_addresses"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+	LeaseID     string    `json:"lease_id,omitempty"`
+}
+
+func runCertShow(ctx context.Context, s *session, args []string) error {
+	fs := flag.NewFlagSet("cert show", flag.ContinueOnError)
+	if err := parseFlags("cert show", fs, args); err != nil {
+		return err
+	}
+
+	cert, err := s.certificate(ctx)
+	if err != nil {
+		return err
+	}
+	return s.out.Print(describeCertificate(cert.Bundle.Certificate, cert.Secret.LeaseID))
+}
+
+func describeCertificate(cert *x509.Certificate, leaseID string) certificateInfo {
+	info := certificateInfo{
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		Serial:    certutil.GetHexFormatted(cert.SerialNumber.Bytes(), ":"),
+		DNSNames:  cert.DNSNames,
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+		LeaseID:   leaseID,
+	}
+	for _, ip := range cert.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	return info
+}
+
+// tokenInfo describes the access token the client authenticates with, from
+// its unverified claims.
+type tokenInfo struct {
+	Type     string    `json:"type"`
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer"`
+	Audience []string  `json:"audience"`
+	Scope    string    `json:"scope"`
+	Expiry   time.Time `json:"expiry"`
+}
+
+func runTokenShow(ctx context.Context, s *session, args []string) error {
+	fs := flag.NewFlagSet("token show", flag.ContinueOnError)
+	raw := fs.Bool("raw", false, "print only the access token, for use with other tools")
+	if err := parseFlags("token show", fs, args); err != nil {
+		return err
+	}
+
+	tokens, err := s.tokenSource(ctx)
+	if err != nil {
+		return err
+	}
+	token, err := tokens.Token()
+	if err != nil {
+		return startup.FetchToken.Wrap(err)
+	}
+	if *raw {
+		fmt.Println(token.AccessToken)
+		return nil
+	}
+	return s.out.Print(describeToken(token))
+}
+
+func describeToken(token *oauth2.Token) tokenInfo {
+	info := tokenInfo{Type: token.Type(), Expiry: token.Expiry}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(token.AccessToken, claims); err != nil {
+		return info
+	}
+	info.Subject, _ = claims["sub"].(string)
+	info.Issuer, _ = claims["iss"].(string)
+	info.Scope, _ = claims["scope"].(string)
+	switch aud := claims["aud"].(type) {
+	case string:
+		info.Audience = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				info.Audience = append(info.Audience, s)
+			}
+		}
+	}
+	return info
+}
+
+// logStatus logs a failed call together with any error details the server
+// attached to it.
+func logStatus(method string, err error) {
+	st := status.Convert(err)
+	log.Printf("%s failed: code=%s message=%q request_id=%s", method, st.Code(), st.Message(), middleware.RequestIDFromError(err))
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			log.Printf("  error info: reason=%s domain=%s metadata=%v", d.GetReason(), d.GetDomain(), d.GetMetadata())
+		case *errdetails.RetryInfo:
+			log.Printf("  retry after %s", d.GetRetryDelay().AsDuration())
+		case *errdetails.QuotaFailure:
+			for _, v := range d.GetViolations() {
+				log.Printf("  quota exceeded for %s: %s", v.GetSubject(), v.GetDescription())
+			}
+		case *errdetails.BadRequest:
+			for _, v := range d.GetFieldViolations() {
+				log.Printf("  invalid field %s: %s", v.GetField(), v.GetDescription())
+			}
+		default:
+			log.Printf("  detail: %v", d)
+		}
+	}
+}
+
+// retryDelay returns the delay from the RetryInfo detail of err, if any.
+func retryDelay(err error) (time.Duration, bool) {
+	for _, detail := range status.Convert(err).Details() {
+		if d, ok := detail.(*errdetails.RetryInfo); ok {
+			return d.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return 0, false
+}
+
+// tokenSource returns a client credentials token source for the Auth0
+// application stored in Vault, fetching the first token up front so that bad
+// credentials are reported at startup.
+func tokenSource(ctx context.Context, data map[string]interface{}) (oauth2.TokenSource, error) {
+	fields := map[string]string{}
+	for _, key := range []string{"id", "secret", "url", "audience"} {
+		value, ok := data[key].(string)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("auth0 secret is missing %q", key)
+		}
+		fields[key] = value
+	}
+
+	tokenConfig := clientcredentials.Config{
+		ClientID:       fields["id"],
+		ClientSecret:   fields["secret"],
+		TokenURL:       fields["url"],
+		EndpointParams: url.Values{"audience": {fields["audience"]}},
+		AuthStyle:      oauth2.AuthStyleInParams,
+	}
+
+	tokens := tokenConfig.TokenSource(ctx)
+	if _, err := tokens.Token(); err != nil {
+		return nil, err
 	}
+	return tokens, nil
 }
@@ -0,0 +1,657 @@
+// Package config loads the settings shared by the server and client binaries.
+//
+// Values are resolved in increasing order of precedence from built-in
+// defaults, an optional YAML file, environment variables and finally
+// command-line flags.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	// ListenAddr is the address the server accepts gRPC connections on.
+	ListenAddr string `yaml:"listen_addr"`
+	// UnixSocket, when set, is the path of a Unix domain socket the server
+	// accepts connections on in addition to ListenAddr.
+	UnixSocket string `yaml:"unix_socket"`
+	// HealthAddr, when set, serves the health service in plaintext so that
+	// kubelet probes work without a client certificate.
+	HealthAddr string `yaml:"health_addr"`
+	// GatewayAddr, when set, serves the REST/JSON gateway over HTTPS.
+	GatewayAddr string `yaml:"gateway_addr"`
+	// AdminAddr, when set, serves reflection and channelz on a separate
+	// listener that requires both a client certificate and AdminToken.
+	AdminAddr  string `yaml:"admin_addr"`
+	AdminToken string `yaml:"admin_token"`
+	// XDS makes the server take its listener configuration from the xDS
+	// control plane named in the file at GRPC_XDS_BOOTSTRAP.
+	XDS bool `yaml:"xds"`
+	// TargetAddr is the server address the client dials.
+	TargetAddr string `yaml:"target_addr"`
+	// ServiceConfig, when set, is the path of a gRPC service config JSON
+	// file replacing the client's built-in retry and timeout policies.
+	ServiceConfig string `yaml:"service_config"`
+	// ServerName, when set, is the name the server's certificate is verified
+	// against in place of the target's host name, for targets such as a
+	// headless service the certificate does not cover.
+	ServerName string `yaml:"server_name"`
+	// LoadBalancing is the policy spreading the client's calls across the
+	// addresses TargetAddr resolves to: pick_first, round_robin or
+	// least_request. A policy declared in ServiceConfig takes precedence.
+	LoadBalancing string `yaml:"load_balancing"`
+	// ResolveInterval is how often the client re-resolves dns:/// targets.
+	ResolveInterval time.Duration `yaml:"resolve_interval"`
+	// Output is the format the client prints results in: text or json.
+	Output string `yaml:"output"`
+	// Args holds the arguments following the flags, naming the client's
+	// command.
+	Args []string `yaml:"-"`
+
+	DrainDelay      time.Duration `yaml:"drain_delay"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	Vault     Vault     `yaml:"vault"`
+	Auth      Auth      `yaml:"auth"`
+	NewRelic  NewRelic  `yaml:"newrelic"`
+	RateLimit RateLimit `yaml:"rate_limit"`
+
+	Concurrency    Concurrency    `yaml:"concurrency"`
+	Transport      Transport      `yaml:"transport"`
+	Web            Web            `yaml:"web"`
+	CircuitBreaker CircuitBreaker `yaml:"circuit_breaker"`
+	Deadlines      Deadlines      `yaml:"deadlines"`
+	Record         Record         `yaml:"record"`
+}
+
+type Vault struct {
+	Address string `yaml:"address"`
+	Token   string `yaml:"token"`
+	// IssuePath is the PKI role endpoint certificates are issued from.
+	IssuePath  string `yaml:"issue_path"`
+	CommonName string `yaml:"common_name"`
+	AltNames   string `yaml:"alt_names"`
+	// Auth0Path is the KV secret holding the client's OAuth credentials.
+	Auth0Path string `yaml:"auth0_path"`
+}
+
+type Auth struct {
+	Scope    string `yaml:"scope"`
+	Audience string `yaml:"audience"`
+	Issuer   string `yaml:"issuer"`
+	Subject  string `yaml:"subject"`
+	JWKSURL  string `yaml:"jwks_url"`
+}
+
+type NewRelic struct {
+	AppName string `yaml:"app_name"`
+	License string `yaml:"license"`
+}
+
+// RateLimit configures the token buckets each caller is given on the server.
+type RateLimit struct {
+	// Default applies to every method without an entry in Methods.
+	Default Limit `yaml:"default"`
+	// Methods overrides the limit for individual full method names such as
+	// "/hello.v1.HelloService/SayHello".
+	Methods map[string]Limit `yaml:"methods"`
+}
+
+// Limit allows Rate requests per second with bursts of up to Burst requests.
+// A zero Rate disables limiting.
+type Limit struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// Concurrency configures the adaptive limit on requests in flight on the
+// server. A zero MaxLimit disables it.
+type Concurrency struct {
+	InitialLimit int `yaml:"initial_limit"`
+	MinLimit     int `yaml:"min_limit"`
+	MaxLimit     int `yaml:"max_limit"`
+	// LatencyThreshold is the request latency above which the server is
+	// considered overloaded and the limit is decreased.
+	LatencyThreshold time.Duration `yaml:"latency_threshold"`
+	// BackoffRatio is the factor the limit is multiplied by on overload.
+	BackoffRatio float64 `yaml:"backoff_ratio"`
+}
+
+// CircuitBreaker configures the client's circuit breakers, one per target
+// and method. A zero FailureThreshold disables them.
+type CircuitBreaker struct {
+	// FailureThreshold is the number of consecutive failed calls that opens
+	// a circuit, failing further calls without sending them.
+	FailureThreshold int `yaml:"failure_threshold"`
+	// OpenTimeout is how long a circuit stays open before trial calls are
+	// let through.
+	OpenTimeout time.Duration `yaml:"open_timeout"`
+	// HalfOpenSuccesses is the number of consecutive successful trial calls
+	// that closes the circuit again.
+	HalfOpenSuccesses int `yaml:"half_open_successes"`
+}
+
+// Deadlines configures the deadlines calls are given by the client and
+// accepted with by the server.
+type Deadlines struct {
+	// Default is the deadline the client gives calls made without one. Zero
+	// leaves such calls without a deadline.
+	Default time.Duration `yaml:"default"`
+	// Methods overrides Default for individual full method names such as
+	// "/hello.v1.HelloService/SayHello".
+	Methods map[string]time.Duration `yaml:"methods"`
+	// Max is the longest deadline the server serves a call with. Calls
+	// arriving without a deadline or with a later one are cut short to Max.
+	// Zero disables the cap.
+	Max time.Duration `yaml:"max"`
+}
+
+// Record configures recording the unary calls the server receives, for the
+// client to replay.
+type Record struct {
+	// Path, when set, is the JSON Lines file calls are appended to.
+	Path string `yaml:"path"`
+	// Metadata lists the request metadata keys recorded with each call.
+	// Credentials are never recorded.
+	Metadata []string `yaml:"metadata"`
+}
+
+// Transport configures connection management and message limits on the
+// server. Zero durations and sizes leave the gRPC defaults in place.
+type Transport struct {
+	// MaxConnectionAge bounds how long a client may keep a connection so that
+	// load is rebalanced onto new pods, with MaxConnectionAgeGrace allowed
+	// for in-flight RPCs to finish.
+	MaxConnectionAge      time.Duration `yaml:"max_connection_age"`
+	MaxConnectionAgeGrace time.Duration `yaml:"max_connection_age_grace"`
+	MaxConnectionIdle     time.Duration `yaml:"max_connection_idle"`
+	// KeepaliveTime is how long a connection may be idle before the server
+	// pings the client, and KeepaliveTimeout how long it waits for the ack.
+	KeepaliveTime    time.Duration `yaml:"keepalive_time"`
+	KeepaliveTimeout time.Duration `yaml:"keepalive_timeout"`
+	// MinPingInterval is the shortest interval between client pings the
+	// server tolerates before closing the connection.
+	MinPingInterval     time.Duration `yaml:"min_ping_interval"`
+	PermitWithoutStream bool          `yaml:"permit_without_stream"`
+
+	MaxRecvMsgSize       int `yaml:"max_recv_msg_size"`
+	MaxSendMsgSize       int `yaml:"max_send_msg_size"`
+	MaxConcurrentStreams int `yaml:"max_concurrent_streams"`
+}
+
+// Web configures serving gRPC-Web and the Connect protocol next to native gRPC
+// on the server's listeners.
+type Web struct {
+	Enabled bool `yaml:"enabled"`
+	// AllowedOrigins lists the origins browsers may call the server from.
+	// CORS is not enabled when it is empty.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+// Default returns the configuration used when nothing else is provided.
+func Default() *Config {
+	return &Config{
+		ListenAddr:      ":3000",
+		TargetAddr:      "localhost:3000",
+		LoadBalancing:   "round_robin",
+		ResolveInterval: 30 * time.Second,
+		Output:          "text",
+		DrainDelay:      5 * time.Second,
+		ShutdownTimeout: 20 * time.Second,
+		Vault: Vault{
+			Token:      "root",
+			IssuePath:  "grpc/issue/hello-service",
+			CommonName: "grpc.example.com",
+			AltNames:   "localhost",
+			Auth0Path:  "hello-service/data/auth0",
+		},
+		NewRelic: NewRelic{
+			AppName: "gRPC Server",
+		},
+		Concurrency: Concurrency{
+			InitialLimit:     100,
+			MinLimit:         10,
+			MaxLimit:         1000,
+			LatencyThreshold: 500 * time.Millisecond,
+			BackoffRatio:     0.9,
+		},
+		CircuitBreaker: CircuitBreaker{
+			FailureThreshold:  5,
+			OpenTimeout:       10 * time.Second,
+			HalfOpenSuccesses: 2,
+		},
+		Deadlines: Deadlines{
+			Default: 10 * time.Second,
+			Max:     30 * time.Second,
+		},
+		Transport: Transport{
+			MaxConnectionAge:      5 * time.Minute,
+			MaxConnectionAgeGrace: 30 * time.Second,
+			KeepaliveTime:         time.Minute,
+			KeepaliveTimeout:      20 * time.Second,
+			MinPingInterval:       10 * time.Second,
+			PermitWithoutStream:   true,
+			MaxRecvMsgSize:        4 << 20,
+			MaxSendMsgSize:        4 << 20,
+			MaxConcurrentStreams:  1000,
+		},
+	}
+}
+
+type field struct {
+	flag  string
+	env   string
+	usage string
+	set   value
+}
+
+// value is implemented by setter and boolSetter.
+type value interface {
+	Set(string) error
+}
+
+type setter func(string) error
+
+func (s setter) Set(v string) error { return s(v) }
+
+// boolSetter is a setter for flags that need no argument.
+type boolSetter func(string) error
+
+func (s boolSetter) Set(v string) error { return s(v) }
+
+// flagValue records a flag so it can be applied after the config file and
+// environment.
+type flagValue struct {
+	field   field
+	flagged *[]func() error
+}
+
+func (v *flagValue) String() string { return "" }
+
+func (v *flagValue) Set(s string) error {
+	*v.flagged = append(*v.flagged, func() error {
+		if err := v.field.set.Set(s); err != nil {
+			return fmt.Errorf("-%s: %w", v.field.flag, err)
+		}
+		return nil
+	})
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	_, ok := v.field.set.(boolSetter)
+	return ok
+}
+
+func (c *Config) fields() []field {
+	return []field{
+		{"", "PORT", "", setPort(&c.ListenAddr)},
+		{"listen-addr", "LISTEN_ADDR", "address to serve gRPC on", setString(&c.ListenAddr)},
+		{"unix-socket", "UNIX_SOCKET", "path of a Unix domain socket to serve gRPC on", setString(&c.UnixSocket)},
+		{"", "HEALTH_PORT", "", setPort(&c.HealthAddr)},
+		{"health-addr", "HEALTH_ADDR", "plaintext address to serve health checks on", setString(&c.HealthAddr)},
+		{"gateway-addr", "GATEWAY_ADDR", "address to serve the REST/JSON gateway on", setString(&c.GatewayAddr)},
+		{"admin-addr", "ADMIN_ADDR", "address to serve reflection and channelz on", setString(&c.AdminAddr)},
+		{"admin-token", "ADMIN_TOKEN", "bearer token required on the admin listener", setString(&c.AdminToken)},
+		{"xds", "XDS_ENABLED", "serve as an xDS-enabled server configured by the control plane in GRPC_XDS_BOOTSTRAP", setBool(&c.XDS)},
+		{"target-addr", "SERVER_ADDR", "server address for the client to dial", setString(&c.TargetAddr)},
+		{"service-config", "SERVICE_CONFIG", "path of a gRPC service config JSON file for the client", setString(&c.ServiceConfig)},
+		{"server-name", "TLS_SERVER_NAME", "name to verify the server's certificate against", setString(&c.ServerName)},
+		{"load-balancing", "LOAD_BALANCING_POLICY", "client load balancing policy: pick_first, round_robin or least_request", setString(&c.LoadBalancing)},
+		{"resolve-interval", "DNS_RESOLVE_INTERVAL", "how often the client re-resolves dns:/// targets", setDuration(&c.ResolveInterval)},
+		{"output", "OUTPUT", "format the client prints results in: text or json", setString(&c.Output)},
+		{"drain-delay", "DRAIN_DELAY", "time to wait after failing health checks before stopping", setDuration(&c.DrainDelay)},
+		{"shutdown-timeout", "SHUTDOWN_TIMEOUT", "time allowed for in-flight RPCs to finish", setDuration(&c.ShutdownTimeout)},
+		{"vault-addr", "VAULT_ADDR", "Vault address", setString(&c.Vault.Address)},
+		{"vault-token", "VAULT_TOKEN", "Vault token", setString(&c.Vault.Token)},
+		{"vault-issue-path", "VAULT_ISSUE_PATH", "Vault PKI path to issue certificates from", setString(&c.Vault.IssuePath)},
+		{"common-name", "CERT_COMMON_NAME", "common name of the issued certificate", setString(&c.Vault.CommonName)},
+		{"alt-names", "CERT_ALT_NAMES", "comma separated subject alternative names", setString(&c.Vault.AltNames)},
+		{"vault-auth0-path", "VAULT_AUTH0_PATH", "Vault KV path of the Auth0 client credentials", setString(&c.Vault.Auth0Path)},
+		{"auth-scope", "AUTH0_SCOPE", "scope required in bearer tokens", setString(&c.Auth.Scope)},
+		{"auth-audience", "AUTH0_AUDIENCE", "audience required in bearer tokens", setString(&c.Auth.Audience)},
+		{"auth-issuer", "AUTH0_ISSUER", "issuer required in bearer tokens", setString(&c.Auth.Issuer)},
+		{"auth-subject", "AUTH0_SUBJECT", "subject required in bearer tokens", setString(&c.Auth.Subject)},
+		{"jwks-url", "JWKS_URL", "URL of the JSON Web Key Set used to verify tokens", setString(&c.Auth.JWKSURL)},
+		{"newrelic-app-name", "NEWRELIC_APP_NAME", "New Relic application name", setString(&c.NewRelic.AppName)},
+		{"newrelic-license", "NEWRELIC_API_KEY", "New Relic license key", setString(&c.NewRelic.License)},
+		{"rate-limit", "RATE_LIMIT", "requests per second allowed per caller, 0 to disable", setFloat(&c.RateLimit.Default.Rate)},
+		{"rate-burst", "RATE_BURST", "burst size allowed per caller", setInt(&c.RateLimit.Default.Burst)},
+		{"concurrency-initial", "CONCURRENCY_INITIAL_LIMIT", "initial limit on requests in flight", setInt(&c.Concurrency.InitialLimit)},
+		{"concurrency-min", "CONCURRENCY_MIN_LIMIT", "lowest the limit on requests in flight can drop to", setInt(&c.Concurrency.MinLimit)},
+		{"concurrency-max", "CONCURRENCY_MAX_LIMIT", "highest the limit on requests in flight can grow to, 0 to disable", setInt(&c.Concurrency.MaxLimit)},
+		{"concurrency-latency", "CONCURRENCY_LATENCY_THRESHOLD", "request latency above which the limit on requests in flight is decreased", setDuration(&c.Concurrency.LatencyThreshold)},
+		{"max-connection-age", "MAX_CONNECTION_AGE", "maximum age of a client connection", setDuration(&c.Transport.MaxConnectionAge)},
+		{"max-connection-age-grace", "MAX_CONNECTION_AGE_GRACE", "time allowed for RPCs to finish on a connection past its maximum age", setDuration(&c.Transport.MaxConnectionAgeGrace)},
+		{"max-connection-idle", "MAX_CONNECTION_IDLE", "time after which an idle connection is closed", setDuration(&c.Transport.MaxConnectionIdle)},
+		{"keepalive-time", "KEEPALIVE_TIME", "idle time before the server pings a client", setDuration(&c.Transport.KeepaliveTime)},
+		{"keepalive-timeout", "KEEPALIVE_TIMEOUT", "time to wait for a keepalive ping ack", setDuration(&c.Transport.KeepaliveTimeout)},
+		{"keepalive-min-time", "KEEPALIVE_MIN_TIME", "minimum interval between client keepalive pings", setDuration(&c.Transport.MinPingInterval)},
+		{"keepalive-permit-without-stream", "KEEPALIVE_PERMIT_WITHOUT_STREAM", "allow client keepalive pings without active streams", setBool(&c.Transport.PermitWithoutStream)},
+		{"max-recv-msg-size", "MAX_RECV_MSG_SIZE", "largest message in bytes the server accepts", setInt(&c.Transport.MaxRecvMsgSize)},
+		{"max-send-msg-size", "MAX_SEND_MSG_SIZE", "largest message in bytes the server sends", setInt(&c.Transport.MaxSendMsgSize)},
+		{"max-concurrent-streams", "MAX_CONCURRENT_STREAMS", "maximum concurrent streams per connection", setInt(&c.Transport.MaxConcurrentStreams)},
+		{"circuit-failure-threshold", "CIRCUIT_FAILURE_THRESHOLD", "consecutive failed calls that open the client's circuit breaker", setInt(&c.CircuitBreaker.FailureThreshold)},
+		{"circuit-open-timeout", "CIRCUIT_OPEN_TIMEOUT", "time an open circuit waits before letting trial calls through", setDuration(&c.CircuitBreaker.OpenTimeout)},
+		{"circuit-half-open-successes", "CIRCUIT_HALF_OPEN_SUCCESSES", "successful trial calls that close the circuit again", setInt(&c.CircuitBreaker.HalfOpenSuccesses)},
+		{"call-timeout", "CALL_TIMEOUT", "deadline the client gives calls, 0 for none", setDuration(&c.Deadlines.Default)},
+		{"max-deadline", "MAX_DEADLINE", "longest deadline the server serves a call with, 0 for no limit", setDuration(&c.Deadlines.Max)},
+		{"record", "RECORD_PATH", "JSON Lines file to record the server's unary calls to", setString(&c.Record.Path)},
+		{"record-metadata", "RECORD_METADATA", "comma separated request metadata keys to record with each call", setList(&c.Record.Metadata)},
+		{"web", "WEB_ENABLED", "also serve gRPC-Web and the Connect protocol", setBool(&c.Web.Enabled)},
+		{"cors-allowed-origins", "CORS_ALLOWED_ORIGINS", "comma separated origins allowed to call the server from a browser", setList(&c.Web.AllowedOrigins)},
+	}
+}
+
+// Load resolves the configuration for the named binary from args, the
+// environment and the YAML file given by -config or CONFIG_FILE.
+func Load(name string, args []string) (*Config, error) {
+	return load(name, args, os.LookupEnv)
+}
+
+func load(name string, args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := Default()
+	fields := cfg.fields()
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	file, _ := lookupEnv("CONFIG_FILE")
+	fs.StringVar(&file, "config", file, "path to a YAML configuration file")
+
+	// Flags are parsed first to find the config file but applied last, so
+	// they are recorded here and replayed once the file and environment
+	// have been applied.
+	var flagged []func() error
+	for _, f := range fields {
+		if f.flag == "" {
+			continue
+		}
+		fs.Var(&flagValue{field: f, flagged: &flagged}, f.flag, f.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if file != "" {
+		if err := cfg.readFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs Errors
+	for _, f := range fields {
+		if v, ok := lookupEnv(f.env); ok && v != "" {
+			if err := f.set.Set(v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", f.env, err))
+			}
+		}
+	}
+	for _, set := range flagged {
+		if err := set(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	cfg.Args = fs.Args()
+	return cfg, nil
+}
+
+func (c *Config) readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// ValidateServer reports every setting missing or invalid for the server.
+func (c *Config) ValidateServer() error {
+	var errs Errors
+	if len(c.Args) > 0 {
+		errs = append(errs, fmt.Errorf("unexpected arguments %q", c.Args))
+	}
+	errs.address("listen address", c.ListenAddr, c.UnixSocket == "")
+	errs.address("health address", c.HealthAddr, false)
+	errs.address("gateway address", c.GatewayAddr, false)
+	errs.address("admin address", c.AdminAddr, false)
+	if c.AdminAddr != "" {
+		errs.required("admin token", c.AdminToken)
+	}
+	if c.XDS && c.Web.Enabled {
+		errs = append(errs, fmt.Errorf("web protocols cannot be served by an xDS-enabled server"))
+	}
+	errs.duration("drain delay", c.DrainDelay)
+	errs.duration("shutdown timeout", c.ShutdownTimeout)
+	c.validateVault(&errs)
+	errs.required("auth scope", c.Auth.Scope)
+	errs.required("auth audience", c.Auth.Audience)
+	errs.required("auth issuer", c.Auth.Issuer)
+	errs.required("auth subject", c.Auth.Subject)
+	errs.required("JWKS URL", c.Auth.JWKSURL)
+	errs.required("New Relic license", c.NewRelic.License)
+	errs.limit("default rate limit", c.RateLimit.Default)
+	for method, limit := range c.RateLimit.Methods {
+		errs.limit(fmt.Sprintf("rate limit for %s", method), limit)
+	}
+	errs.duration("max deadline", c.Deadlines.Max)
+	for _, key := range c.Record.Metadata {
+		if strings.EqualFold(key, "authorization") {
+			errs = append(errs, fmt.Errorf("recorded metadata must not include authorization"))
+		}
+	}
+	errs.concurrency(c.Concurrency)
+	errs.transport(c.Transport)
+	return errs.err()
+}
+
+// ValidateClient reports every setting missing or invalid for the client.
+func (c *Config) ValidateClient() error {
+	var errs Errors
+	errs.required("target address", c.TargetAddr)
+	switch c.LoadBalancing {
+	case "", "pick_first", "round_robin", "least_request":
+	default:
+		errs = append(errs, fmt.Errorf("load balancing policy %q is not one of pick_first, round_robin or least_request", c.LoadBalancing))
+	}
+	errs.duration("resolve interval", c.ResolveInterval)
+	switch c.Output {
+	case "text", "json":
+	default:
+		errs = append(errs, fmt.Errorf("output format %q is not one of text or json", c.Output))
+	}
+	errs.circuitBreaker(c.CircuitBreaker)
+	errs.duration("call timeout", c.Deadlines.Default)
+	for method, timeout := range c.Deadlines.Methods {
+		errs.duration(fmt.Sprintf("call timeout for %s", method), timeout)
+	}
+	c.validateVault(&errs)
+	errs.required("Vault Auth0 path", c.Vault.Auth0Path)
+	return errs.err()
+}
+
+func (c *Config) validateVault(errs *Errors) {
+	errs.required("Vault address", c.Vault.Address)
+	errs.required("Vault token", c.Vault.Token)
+	errs.required("Vault issue path", c.Vault.IssuePath)
+	errs.required("certificate common name", c.Vault.CommonName)
+}
+
+// Errors aggregates every problem found while loading or validating a
+// configuration so they can be reported together.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e Errors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *Errors) required(name, value string) {
+	if value == "" {
+		*e = append(*e, fmt.Errorf("%s is required", name))
+	}
+}
+
+func (e *Errors) address(name, value string, required bool) {
+	if value == "" {
+		if required {
+			e.required(name, value)
+		}
+		return
+	}
+	if _, _, err := net.SplitHostPort(value); err != nil {
+		*e = append(*e, fmt.Errorf("%s %q is invalid: %w", name, value, err))
+	}
+}
+
+func (e *Errors) duration(name string, value time.Duration) {
+	if value < 0 {
+		*e = append(*e, fmt.Errorf("%s must not be negative", name))
+	}
+}
+
+func (e *Errors) limit(name string, value Limit) {
+	if value.Rate < 0 {
+		*e = append(*e, fmt.Errorf("%s must not be negative", name))
+	}
+	if value.Rate > 0 && value.Burst < 1 {
+		*e = append(*e, fmt.Errorf("%s needs a burst of at least 1", name))
+	}
+}
+
+func (e *Errors) circuitBreaker(value CircuitBreaker) {
+	if value.FailureThreshold == 0 {
+		return
+	}
+	if value.FailureThreshold < 0 {
+		*e = append(*e, fmt.Errorf("circuit breaker failure threshold must not be negative"))
+	}
+	if value.OpenTimeout <= 0 {
+		*e = append(*e, fmt.Errorf("circuit breaker open timeout must be positive"))
+	}
+	if value.HalfOpenSuccesses < 1 {
+		*e = append(*e, fmt.Errorf("circuit breaker needs at least 1 half-open success"))
+	}
+}
+
+func (e *Errors) concurrency(value Concurrency) {
+	if value.MaxLimit == 0 {
+		return
+	}
+	if value.MinLimit < 1 || value.MinLimit > value.InitialLimit || value.InitialLimit > value.MaxLimit {
+		*e = append(*e, fmt.Errorf("concurrency limits must satisfy 1 <= min (%d) <= initial (%d) <= max (%d)", value.MinLimit, value.InitialLimit, value.MaxLimit))
+	}
+	if value.LatencyThreshold <= 0 {
+		*e = append(*e, fmt.Errorf("concurrency latency threshold must be positive"))
+	}
+	if value.BackoffRatio <= 0 || value.BackoffRatio >= 1 {
+		*e = append(*e, fmt.Errorf("concurrency backoff ratio must be between 0 and 1"))
+	}
+}
+
+func (e *Errors) transport(value Transport) {
+	e.duration("max connection age", value.MaxConnectionAge)
+	e.duration("max connection age grace", value.MaxConnectionAgeGrace)
+	e.duration("max connection idle", value.MaxConnectionIdle)
+	e.duration("keepalive time", value.KeepaliveTime)
+	e.duration("keepalive timeout", value.KeepaliveTimeout)
+	e.duration("keepalive min time", value.MinPingInterval)
+	if value.MaxRecvMsgSize < 0 || value.MaxSendMsgSize < 0 || value.MaxConcurrentStreams < 0 {
+		*e = append(*e, fmt.Errorf("message sizes and max concurrent streams must not be negative"))
+	}
+}
+
+func setString(p *string) setter {
+	return func(v string) error {
+		*p = v
+		return nil
+	}
+}
+
+func setPort(p *string) setter {
+	return func(v string) error {
+		*p = net.JoinHostPort("", v)
+		return nil
+	}
+}
+
+func setList(p *[]string) setter {
+	return func(v string) error {
+		*p = nil
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*p = append(*p, item)
+			}
+		}
+		return nil
+	}
+}
+
+func setBool(p *bool) boolSetter {
+	return func(v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*p = b
+		return nil
+	}
+}
+
+func setFloat(p *float64) setter {
+	return func(v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		*p = f
+		return nil
+	}
+}
+
+func setInt(p *int) setter {
+	return func(v string) error {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*p = i
+		return nil
+	}
+}
+
+func setDuration(p *time.Duration) setter {
+	return func(v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*p = d
+		return nil
+	}
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(file, []byte(`
+listen_addr: ":4000"
+target_addr: "file:4000"
+drain_delay: 1s
+vault:
+  common_name: file.example.com
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"CONFIG_FILE": file,
+		"PORT":        "5000",
+		"SERVER_ADDR": "env:5000",
+	}
+	lookupEnv := func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+
+	cfg, err := load("test", []string{"-target-addr", "flag:6000", "user", "get", "-id", "jamie"}, lookupEnv)
+	if err != nil {
+		t.Fatalf("load() got unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"default", cfg.Vault.IssuePath, "grpc/issue/hello-service"},
+		{"file", cfg.Vault.CommonName, "file.example.com"},
+		{"file duration", cfg.DrainDelay, time.Second},
+		{"env over file", cfg.ListenAddr, ":5000"},
+		{"flag over env", cfg.TargetAddr, "flag:6000"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, wanted %v", tt.name, tt.got, tt.want)
+		}
+	}
+	if got := strings.Join(cfg.Args, " "); got != "user get -id jamie" {
+		t.Errorf("args: got %q, wanted %q", got, "user get -id jamie")
+	}
+}
+
+func TestLoadBoolFlag(t *testing.T) {
+	lookupEnv := func(key string) (string, bool) { return "", false }
+
+	cfg, err := load("test", []string{"-web", "-target-addr", "flag:6000"}, lookupEnv)
+	if err != nil {
+		t.Fatalf("load() got unexpected error: %v", err)
+	}
+	if !cfg.Web.Enabled {
+		t.Errorf("load() got web.enabled false, wanted true")
+	}
+	if cfg.TargetAddr != "flag:6000" {
+		t.Errorf("load() got target %q, wanted %q", cfg.TargetAddr, "flag:6000")
+	}
+}
+
+func TestLoadInvalidValues(t *testing.T) {
+	lookupEnv := func(key string) (string, bool) {
+		if key == "DRAIN_DELAY" {
+			return "soon", true
+		}
+		return "", false
+	}
+
+	_, err := load("test", []string{"-shutdown-timeout", "later"}, lookupEnv)
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("load() got error %v, wanted Errors", err)
+	}
+	if len(errs) != 2 {
+		t.Errorf("load() got %d errors, wanted 2: %v", len(errs), errs)
+	}
+}
+
+func TestValidateServer(t *testing.T) {
+	cfg := Default()
+	cfg.ListenAddr = "3000"
+
+	err := cfg.ValidateServer()
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("ValidateServer() got error %v, wanted Errors", err)
+	}
+	// invalid listen address, Vault address, five auth settings and the
+	// New Relic license
+	if len(errs) != 8 {
+		t.Errorf("ValidateServer() got %d errors, wanted 8: %v", len(errs), errs)
+	}
+}
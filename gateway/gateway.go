@@ -0,0 +1,55 @@
+// Package gateway exposes the gRPC services as a REST/JSON API using the
+// handlers generated by grpc-gateway from the HTTP annotations in
+// hello/v1/hello.proto.
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	pb "github.com/jamiewhitney/grpc-go-vault/hello/v1"
+	"github.com/jamiewhitney/grpc-go-vault/middleware"
+	"google.golang.org/grpc"
+)
+
+// New returns a handler proxying REST/JSON requests to the gRPC server on
+// conn and serving the OpenAPI document at /openapi.json. The caller's
+// Authorization header is forwarded as the "authorization" metadata the
+// server's authorizer expects, and the X-Request-Id header is passed through
+// in both directions.
+func New(ctx context.Context, conn *grpc.ClientConn) (http.Handler, error) {
+	gwmux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(incomingHeader),
+		runtime.WithOutgoingHeaderMatcher(outgoingHeader),
+	)
+	if err := pb.RegisterHelloServiceHandler(ctx, gwmux, conn); err != nil {
+		return nil, err
+	}
+	if err := pb.RegisterCreateUserServiceHandler(ctx, gwmux, conn); err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", gwmux)
+	mux.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(pb.OpenAPI)
+	})
+	return mux, nil
+}
+
+func incomingHeader(key string) (string, bool) {
+	if strings.EqualFold(key, middleware.RequestIDKey) {
+		return middleware.RequestIDKey, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+func outgoingHeader(key string) (string, bool) {
+	if key == middleware.RequestIDKey {
+		return http.CanonicalHeaderKey(key), true
+	}
+	return runtime.MetadataHeaderPrefix + key, true
+}
@@ -0,0 +1,163 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jamiewhitney/grpc-go-vault/config"
+	pb "github.com/jamiewhitney/grpc-go-vault/hello/v1"
+	"github.com/jamiewhitney/grpc-go-vault/internal/testutil"
+	"github.com/jamiewhitney/grpc-go-vault/middleware"
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+func newTestGateway(t *testing.T, opts ...grpc.ServerOption) http.Handler {
+	t.Helper()
+
+	s := grpc.NewServer(opts...)
+	pb.RegisterHelloServiceServer(s, &testutil.HelloServer{})
+	handler, err := New(context.Background(), testutil.Dial(t, s))
+	if err != nil {
+		t.Fatalf("New() got unexpected error: %v", err)
+	}
+	return handler
+}
+
+// TestSayHello calls through the authorizer, so only succeeds if the
+// Authorization header is forwarded.
+func TestSayHello(t *testing.T) {
+	handler := newTestGateway(t, grpc.UnaryInterceptor(middleware.UnaryAuthorizer(testutil.Authorizer())))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/hello", strings.NewReader(`{"name":"world"}`))
+	req.Header.Set("Authorization", testutil.Token(t, testutil.Subject))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /v1/hello got status %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Greeting string `json:"greeting"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Hello world"; resp.Greeting != want {
+		t.Errorf("POST /v1/hello got greeting %q, wanted %q", resp.Greeting, want)
+	}
+}
+
+func TestUnauthenticated(t *testing.T) {
+	handler := newTestGateway(t, grpc.UnaryInterceptor(middleware.UnaryAuthorizer(testutil.Authorizer())))
+
+	for _, authorization := range []string{"", "Bearer nonsense"} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/hello", strings.NewReader(`{"name":"world"}`))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), middleware.ReasonInvalidToken) {
+			t.Errorf("POST /v1/hello with authorization %q got status %d: %s", authorization, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	log, _ := test.NewNullLogger()
+	handler := newTestGateway(t, grpc.UnaryInterceptor(middleware.UnaryRequestID(log)))
+
+	tests := []struct {
+		sent   string
+		wanted string
+	}{
+		{"abc-123", "abc-123"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/v1/hello", strings.NewReader(`{"name":"world"}`))
+		if tt.sent != "" {
+			req.Header.Set("X-Request-Id", tt.sent)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		got := rec.Header().Get("X-Request-Id")
+		if got == "" || (tt.wanted != "" && got != tt.wanted) {
+			t.Errorf("POST /v1/hello with request ID %q got X-Request-Id %q", tt.sent, got)
+		}
+	}
+}
+
+// TestRateLimitPerClient checks that REST callers, which all reach the gRPC
+// server over the gateway's connection, are limited separately.
+func TestRateLimitPerClient(t *testing.T) {
+	serial := big.NewInt(0xf00)
+	// asGateway presents the gateway's certificate, as bufconn carries none
+	asGateway := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		cert := &x509.Certificate{SerialNumber: serial}
+		ctx = peer.NewContext(ctx, &peer.Peer{
+			Addr:     &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234},
+			AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}},
+		})
+		return handler(ctx, req)
+	}
+	limiter := middleware.NewRateLimiter(config.RateLimit{Default: config.Limit{Rate: 0.001, Burst: 1}}, []*big.Int{serial}, nil)
+	handler := newTestGateway(t, grpc.ChainUnaryInterceptor(asGateway, limiter.Unary()))
+
+	tests := []struct {
+		remoteAddr string
+		forwarded  string
+		want       int
+	}{
+		{"192.0.2.1:1234", "", http.StatusOK},
+		{"192.0.2.1:1234", "", http.StatusTooManyRequests},
+		{"192.0.2.2:1234", "", http.StatusOK},
+		// a client cannot borrow another's bucket by naming it
+		{"192.0.2.3:1234", "192.0.2.4", http.StatusOK},
+		{"192.0.2.4:1234", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/v1/hello", strings.NewReader(`{"name":"world"}`))
+		req.RemoteAddr = tt.remoteAddr
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("POST /v1/hello from %s got status %d, wanted %d: %s", tt.remoteAddr, rec.Code, tt.want, rec.Body)
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	handler := newTestGateway(t)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	var doc struct {
+		Swagger string                     `json:"swagger"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("GET /openapi.json returned invalid JSON: %v", err)
+	}
+	if doc.Swagger != "2.0" || doc.Paths["/v1/hello"] == nil {
+		t.Errorf("GET /openapi.json got unexpected document: %s", rec.Body)
+	}
+}
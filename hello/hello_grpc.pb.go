@@ -21,6 +21,8 @@ const _ = grpc.SupportPackageIsVersion7
 // HelloServiceClient is the client API for HelloService service.
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Deprecated: Do not use.
 type HelloServiceClient interface {
 	SayHello(ctx context.Context, in *HelloRequest, opts ...grpc.CallOption) (*HelloRequest, error)
 }
@@ -29,6 +31,7 @@ type helloServiceClient struct {
 	cc grpc.ClientConnInterface
 }
 
+// Deprecated: Do not use.
 func NewHelloServiceClient(cc grpc.ClientConnInterface) HelloServiceClient {
 	return &helloServiceClient{cc}
 }
@@ -45,6 +48,8 @@ func (c *helloServiceClient) SayHello(ctx context.Context, in *HelloRequest, opt
 // HelloServiceServer is the server API for HelloService service.
 // All implementations must embed UnimplementedHelloServiceServer
 // for forward compatibility
+//
+// Deprecated: Do not use.
 type HelloServiceServer interface {
 	SayHello(context.Context, *HelloRequest) (*HelloRequest, error)
 	mustEmbedUnimplementedHelloServiceServer()
@@ -66,6 +71,7 @@ type UnsafeHelloServiceServer interface {
 	mustEmbedUnimplementedHelloServiceServer()
 }
 
+// Deprecated: Do not use.
 func RegisterHelloServiceServer(s grpc.ServiceRegistrar, srv HelloServiceServer) {
 	s.RegisterService(&HelloService_ServiceDesc, srv)
 }
@@ -107,6 +113,8 @@ var HelloService_ServiceDesc = grpc.ServiceDesc{
 // CreateUserServiceClient is the client API for CreateUserService service.
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Deprecated: Do not use.
 type CreateUserServiceClient interface {
 	CreateUser(ctx context.Context, in *CreateUserRequest, opts ...grpc.CallOption) (*CreateUserResponse, error)
 }
@@ -115,6 +123,7 @@ type createUserServiceClient struct {
 	cc grpc.ClientConnInterface
 }
 
+// Deprecated: Do not use.
 func NewCreateUserServiceClient(cc grpc.ClientConnInterface) CreateUserServiceClient {
 	return &createUserServiceClient{cc}
 }
@@ -131,6 +140,8 @@ func (c *createUserServiceClient) CreateUser(ctx context.Context, in *CreateUser
 // CreateUserServiceServer is the server API for CreateUserService service.
 // All implementations must embed UnimplementedCreateUserServiceServer
 // for forward compatibility
+//
+// Deprecated: Do not use.
 type CreateUserServiceServer interface {
 	CreateUser(context.Context, *CreateUserRequest) (*CreateUserResponse, error)
 	mustEmbedUnimplementedCreateUserServiceServer()
@@ -152,6 +163,7 @@ type UnsafeCreateUserServiceServer interface {
 	mustEmbedUnimplementedCreateUserServiceServer()
 }
 
+// Deprecated: Do not use.
 func RegisterCreateUserServiceServer(s grpc.ServiceRegistrar, srv CreateUserServiceServer) {
 	s.RegisterService(&CreateUserService_ServiceDesc, srv)
 }
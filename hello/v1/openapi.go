@@ -0,0 +1,9 @@
+package hellov1
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI v2 document describing the REST/JSON gateway,
+// generated from hello.proto by protoc-gen-openapiv2.
+//
+//go:embed hello.swagger.json
+var OpenAPI []byte
@@ -0,0 +1,97 @@
+// Package testutil holds the fixtures shared by the tests of the other
+// packages: a HelloService stub, in-memory connections and bearer tokens for
+// a test authorizer.
+package testutil
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+	auth "github.com/jamiewhitney/auth-jwt-grpc"
+	pb "github.com/jamiewhitney/grpc-go-vault/hello/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// HelloServer greets callers with "Hello <name>".
+type HelloServer struct {
+	pb.UnimplementedHelloServiceServer
+}
+
+func (s *HelloServer) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloResponse, error) {
+	return &pb.HelloResponse{Greeting: "Hello " + in.GetName()}, nil
+}
+
+// Dial serves s over an in-memory connection and returns a connection to it
+// dialled with opts. Both are closed when the test ends.
+func Dial(t testing.TB, s *grpc.Server, opts ...grpc.DialOption) *grpc.ClientConn {
+	t.Helper()
+
+	lis := bufconn.Listen(1024 * 1024)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	opts = append(opts,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	conn, err := grpc.Dial("bufconn", opts...)
+	if err != nil {
+		t.Fatalf("did not connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// DialHello serves a HelloServer with opts and returns a client for it.
+func DialHello(t testing.TB, opts ...grpc.ServerOption) pb.HelloServiceClient {
+	t.Helper()
+
+	s := grpc.NewServer(opts...)
+	pb.RegisterHelloServiceServer(s, &HelloServer{})
+	return pb.NewHelloServiceClient(Dial(t, s))
+}
+
+// Subject is the only subject Authorizer accepts.
+const Subject = "client@clients"
+
+var signingKey = []byte("test signing key")
+
+// Authorizer returns an authorizer accepting the tokens returned by Token for
+// Subject.
+func Authorizer() *auth.Authorizer {
+	return &auth.Authorizer{
+		Audience: "hello",
+		Scope:    "read:hello",
+		Issuer:   "https://issuer.example.com/",
+		Subject:  Subject,
+		Jwks:     keyfunc.NewGiven(map[string]keyfunc.GivenKey{"test": keyfunc.NewGivenHMAC(signingKey)}),
+	}
+}
+
+// Token returns an Authorization header carrying a token for subject, signed
+// with the key Authorizer trusts.
+func Token(t testing.TB, subject string) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.MyCustomClaims{
+		Scope: "read:hello",
+		StandardClaims: jwt.StandardClaims{
+			Audience: "hello",
+			Issuer:   "https://issuer.example.com/",
+			Subject:  subject,
+		},
+	})
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(signingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + signed
+}
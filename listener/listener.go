@@ -0,0 +1,106 @@
+// Package listener opens the sockets the server accepts connections on: a TCP
+// address, a Unix domain socket, or listeners inherited through systemd
+// socket activation.
+package listener
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd.
+const listenFdsStart = 3
+
+// Open returns the listeners passed by systemd if the process was socket
+// activated, and otherwise listens on tcpAddr and unixPath, skipping either
+// when empty.
+func Open(tcpAddr, unixPath string) ([]net.Listener, error) {
+	listeners, err := Systemd()
+	if err != nil || len(listeners) > 0 {
+		return listeners, err
+	}
+
+	if tcpAddr != "" {
+		lis, err := net.Listen("tcp", tcpAddr)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, lis)
+	}
+
+	if unixPath != "" {
+		lis, err := Unix(unixPath)
+		if err != nil {
+			Close(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, lis)
+	}
+
+	if len(listeners) == 0 {
+		return nil, fmt.Errorf("no listen address configured")
+	}
+	return listeners, nil
+}
+
+// Unix listens on a Unix domain socket at path, removing a socket left
+// behind by a previous process. The socket file is removed on close.
+func Unix(path string) (net.Listener, error) {
+	if fi, err := os.Stat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// Systemd returns the listeners passed to this process through the
+// LISTEN_FDS protocol, or none if it was not socket activated.
+func Systemd() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", os.Getenv("LISTEN_FDS"))
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	// Unset the variables so they are not inherited by child processes.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(listenFdsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		f := os.NewFile(uintptr(listenFdsStart+i), name)
+		lis, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			Close(listeners)
+			return nil, fmt.Errorf("failed to use inherited socket %s: %w", name, err)
+		}
+		listeners = append(listeners, lis)
+	}
+	return listeners, nil
+}
+
+// Close closes every listener, ignoring errors.
+func Close(listeners []net.Listener) {
+	for _, lis := range listeners {
+		lis.Close()
+	}
+}
@@ -0,0 +1,63 @@
+package listener
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenTCPAndUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "grpc.sock")
+
+	listeners, err := Open("127.0.0.1:0", path)
+	if err != nil {
+		t.Fatalf("Open() got unexpected error: %v", err)
+	}
+	defer Close(listeners)
+
+	if len(listeners) != 2 {
+		t.Fatalf("Open() got %d listeners, wanted 2", len(listeners))
+	}
+	for _, lis := range listeners {
+		conn, err := net.Dial(lis.Addr().Network(), lis.Addr().String())
+		if err != nil {
+			t.Errorf("Dial(%s) got unexpected error: %v", lis.Addr(), err)
+			continue
+		}
+		conn.Close()
+	}
+}
+
+func TestUnixRemovesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "grpc.sock")
+
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Leave the socket file behind as a crashed process would.
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	lis, err := Unix(path)
+	if err != nil {
+		t.Fatalf("Unix() got unexpected error: %v", err)
+	}
+	lis.Close()
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file still exists after close: %v", err)
+	}
+}
+
+func TestUnixRefusesRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "grpc.sock")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Unix(path); err == nil {
+		t.Errorf("Unix() got no error for a regular file")
+	}
+}
@@ -0,0 +1,256 @@
+// Package loadtest drives load against a call in stages, either as a number
+// of workers calling back to back (closed loop) or as a number of calls
+// started per second whatever their latency (constant rate), or replays
+// recorded calls, and reports latency percentiles, throughput and the status
+// codes returned.
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/status"
+)
+
+// Modes of generating load.
+const (
+	// ClosedLoop runs a stage's target number of workers, each making its
+	// next call once the previous one returns.
+	ClosedLoop = "closed"
+	// ConstantRate starts a stage's target number of calls per second,
+	// whether or not earlier calls have returned.
+	ConstantRate = "rate"
+)
+
+// tick is how often the target is recomputed while ramping.
+const tick = 10 * time.Millisecond
+
+// Stage moves the target linearly from the previous stage's target, or 0 for
+// the first stage, to Target over Duration, as k6 stages do.
+type Stage struct {
+	Duration time.Duration
+	Target   int
+}
+
+// ParseStages parses comma separated duration:target pairs such as
+// "30s:100,5m:100,30s:0".
+func ParseStages(s string) ([]Stage, error) {
+	var stages []Stage
+	for _, part := range strings.Split(s, ",") {
+		fields := strings.SplitN(strings.TrimSpace(part), ":", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("stage %q is not duration:target", part)
+		}
+		duration, err := time.ParseDuration(fields[0])
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("stage %q needs a positive duration", part)
+		}
+		target, err := strconv.Atoi(fields[1])
+		if err != nil || target < 0 {
+			return nil, fmt.Errorf("stage %q needs a target of at least 0", part)
+		}
+		stages = append(stages, Stage{Duration: duration, Target: target})
+	}
+	return stages, nil
+}
+
+// target returns the target elapsed into stages, and false once they are
+// over.
+func target(stages []Stage, elapsed time.Duration) (float64, bool) {
+	from := 0.0
+	for _, s := range stages {
+		if elapsed < s.Duration {
+			return from + (float64(s.Target)-from)*float64(elapsed)/float64(s.Duration), true
+		}
+		elapsed -= s.Duration
+		from = float64(s.Target)
+	}
+	return from, false
+}
+
+// Options configure a run.
+type Options struct {
+	Mode   string
+	Stages []Stage
+	// Think is how long each closed loop worker pauses between calls.
+	Think time.Duration
+	// MaxInFlight bounds the calls in flight at a constant rate. Calls due
+	// while it is reached are dropped and counted rather than queued, so
+	// that a slow server cannot lower the rate the remaining calls see.
+	MaxInFlight int
+}
+
+// Call makes one request, returning a status error on failure.
+type Call func(ctx context.Context) error
+
+// Validate reports the first problem with the options.
+func (o Options) Validate() error {
+	if len(o.Stages) == 0 {
+		return fmt.Errorf("at least one stage is required")
+	}
+	switch o.Mode {
+	case ClosedLoop:
+	case ConstantRate:
+		if o.MaxInFlight < 1 {
+			return fmt.Errorf("constant rate needs at least 1 call in flight")
+		}
+	default:
+		return fmt.Errorf("mode %q is not one of %s or %s", o.Mode, ClosedLoop, ConstantRate)
+	}
+	return nil
+}
+
+// Run generates load with call until the stages are over or ctx is done,
+// and reports on the calls made.
+func Run(ctx context.Context, opts Options, call Call) (*Report, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	r := newRecorder()
+	start := time.Now()
+	if opts.Mode == ClosedLoop {
+		closedLoop(ctx, opts, r.record(call))
+	} else {
+		constantRate(ctx, opts, r.record(call), &r.dropped)
+	}
+	return r.report(opts.Mode, time.Since(start)), nil
+}
+
+func closedLoop(ctx context.Context, opts Options, call func(context.Context)) {
+	var (
+		wg      sync.WaitGroup
+		want    int64
+		workers int64
+	)
+	stop := make(chan struct{})
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	// pause waits for d, reporting false if the run stopped meanwhile.
+	pause := func(d time.Duration) bool {
+		select {
+		case <-stop:
+			return false
+		case <-time.After(d):
+			return true
+		}
+	}
+
+	start := time.Now()
+	for ctx.Err() == nil {
+		t, ok := target(opts.Stages, time.Since(start))
+		if !ok {
+			break
+		}
+		atomic.StoreInt64(&want, int64(t))
+
+		// Workers beyond the target park after their current call until it
+		// rises again, so there are never more than the target calling.
+		for ; workers < int64(t); workers++ {
+			wg.Add(1)
+			go func(id int64) {
+				defer wg.Done()
+				for {
+					if id >= atomic.LoadInt64(&want) {
+						if !pause(tick) {
+							return
+						}
+						continue
+					}
+					call(ctx)
+					if opts.Think > 0 && !pause(opts.Think) {
+						return
+					}
+					select {
+					case <-stop:
+						return
+					default:
+					}
+				}
+			}(workers)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func constantRate(ctx context.Context, opts Options, call func(context.Context), dropped *int64) {
+	var wg sync.WaitGroup
+	inFlight := make(chan struct{}, opts.MaxInFlight)
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	start := time.Now()
+	last := start
+	due := 0.0
+	for ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+			continue
+		case now := <-ticker.C:
+			rate, ok := target(opts.Stages, now.Sub(start))
+			if !ok {
+				wg.Wait()
+				return
+			}
+			due += rate * now.Sub(last).Seconds()
+			last = now
+		}
+
+		for ; due >= 1; due-- {
+			select {
+			case inFlight <- struct{}{}:
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					call(ctx)
+					<-inFlight
+				}()
+			default:
+				atomic.AddInt64(dropped, 1)
+			}
+		}
+	}
+	wg.Wait()
+}
+
+type recorder struct {
+	dropped    int64
+	mismatched int64
+
+	mu        sync.Mutex
+	latencies histogram
+	codes     map[string]int64
+}
+
+func newRecorder() *recorder {
+	return &recorder{codes: make(map[string]int64)}
+}
+
+func (r *recorder) record(call Call) func(context.Context) {
+	return func(ctx context.Context) {
+		start := time.Now()
+		err := call(ctx)
+		latency := time.Since(start)
+		// Calls cut short by the end of the run say nothing about the server.
+		if ctx.Err() != nil {
+			return
+		}
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.latencies.add(latency)
+		r.codes[status.Code(err).String()]++
+	}
+}
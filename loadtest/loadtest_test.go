@@ -0,0 +1,182 @@
+package loadtest
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseStages(t *testing.T) {
+	stages, err := ParseStages("2m:400, 1h:400,2m:0")
+	if err != nil {
+		t.Fatalf("ParseStages() got unexpected error: %v", err)
+	}
+	want := []Stage{{2 * time.Minute, 400}, {time.Hour, 400}, {2 * time.Minute, 0}}
+	if len(stages) != len(want) {
+		t.Fatalf("ParseStages() got %v, wanted %v", stages, want)
+	}
+	for i := range want {
+		if stages[i] != want[i] {
+			t.Errorf("ParseStages() stage %d got %v, wanted %v", i, stages[i], want[i])
+		}
+	}
+
+	for _, s := range []string{"", "2m", "2m:-1", "0s:10", "x:10"} {
+		if _, err := ParseStages(s); err == nil {
+			t.Errorf("ParseStages(%q) got no error", s)
+		}
+	}
+}
+
+func TestTarget(t *testing.T) {
+	stages := []Stage{{10 * time.Second, 100}, {10 * time.Second, 100}, {10 * time.Second, 0}}
+
+	tests := []struct {
+		elapsed time.Duration
+		want    float64
+		wantOK  bool
+	}{
+		{0, 0, true},
+		{5 * time.Second, 50, true},
+		{15 * time.Second, 100, true},
+		{25 * time.Second, 50, true},
+		{30 * time.Second, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := target(stages, tt.elapsed)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("target(%s) got %v, %v, wanted %v, %v", tt.elapsed, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestHistogramQuantiles(t *testing.T) {
+	var h histogram
+	for i := 1; i <= 1000; i++ {
+		h.add(time.Duration(i) * time.Millisecond)
+	}
+
+	tests := []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0.5, 500 * time.Millisecond},
+		{0.99, 990 * time.Millisecond},
+		{1, time.Second},
+	}
+	for _, tt := range tests {
+		got := h.quantile(tt.q)
+		if got < tt.want || float64(got) > float64(tt.want)*bucketGrowth {
+			t.Errorf("quantile(%v) got %s, wanted within 1%% above %s", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestRunClosedLoop(t *testing.T) {
+	var inFlight, peak int32
+	call := func(ctx context.Context) error {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		if n%2 == 0 {
+			return status.Error(codes.Unavailable, "busy")
+		}
+		return nil
+	}
+
+	report, err := Run(context.Background(), Options{
+		Mode:   ClosedLoop,
+		Stages: []Stage{{50 * time.Millisecond, 4}, {200 * time.Millisecond, 4}, {50 * time.Millisecond, 0}},
+	}, call)
+	if err != nil {
+		t.Fatalf("Run() got unexpected error: %v", err)
+	}
+
+	if got := atomic.LoadInt32(&peak); got > 4 {
+		t.Errorf("Run() had %d calls in flight, wanted at most 4", got)
+	}
+	if report.Requests == 0 || report.Codes["OK"]+report.Codes["Unavailable"] != report.Requests {
+		t.Errorf("Run() got %d requests with codes %v", report.Requests, report.Codes)
+	}
+	if report.P50 < 5 {
+		t.Errorf("Run() got p50 latency %vms, wanted at least 5ms", report.P50)
+	}
+}
+
+func TestRunConstantRate(t *testing.T) {
+	var calls int32
+	call := func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}
+
+	report, err := Run(context.Background(), Options{
+		Mode:        ConstantRate,
+		Stages:      []Stage{{time.Millisecond, 200}, {500 * time.Millisecond, 200}},
+		MaxInFlight: 10,
+	}, call)
+	if err != nil {
+		t.Fatalf("Run() got unexpected error: %v", err)
+	}
+	// 200 calls per second for half a second
+	if report.Requests < 80 || report.Requests > 110 {
+		t.Errorf("Run() made %d requests, wanted about 100", report.Requests)
+	}
+	if report.Dropped != 0 {
+		t.Errorf("Run() dropped %d calls, wanted none", report.Dropped)
+	}
+}
+
+func TestRunConstantRateDrops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	call := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+	}()
+
+	report, err := Run(ctx, Options{
+		Mode:        ConstantRate,
+		Stages:      []Stage{{time.Millisecond, 100}, {time.Minute, 100}},
+		MaxInFlight: 1,
+	}, call)
+	if err != nil {
+		t.Fatalf("Run() got unexpected error: %v", err)
+	}
+	// the single slot is taken by a call that never returns
+	if report.Dropped < 10 {
+		t.Errorf("Run() dropped %d calls, wanted about 20", report.Dropped)
+	}
+	if report.Requests != 0 {
+		t.Errorf("Run() recorded %d requests cut short by the end of the run", report.Requests)
+	}
+}
+
+func TestRunInvalidOptions(t *testing.T) {
+	stages := []Stage{{time.Second, 1}}
+	tests := []Options{
+		{Mode: ClosedLoop},
+		{Mode: "open", Stages: stages},
+		{Mode: ConstantRate, Stages: stages},
+	}
+	for _, opts := range tests {
+		if _, err := Run(context.Background(), opts, nil); err == nil {
+			t.Errorf("Run(%+v) got no error", opts)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jamiewhitney/grpc-go-vault/recording"
+	"google.golang.org/grpc/status"
+)
+
+// Replay is the mode reported for replayed recordings.
+const Replay = "replay"
+
+// ReplayCall makes the call recorded in an entry.
+type ReplayCall func(ctx context.Context, entry *recording.Entry) error
+
+// RunReplay makes the calls read from r, reporting on them as Run does and
+// counting those whose status code differs from the recorded one.
+//
+// With a positive speed calls are started at the pace they were recorded,
+// sped up by that factor, and calls due while maxInFlight are outstanding
+// are dropped. With speed 0 they are made as fast as maxInFlight allows.
+func RunReplay(ctx context.Context, r *recording.Reader, speed float64, maxInFlight int, call ReplayCall) (*Report, error) {
+	if speed < 0 {
+		return nil, fmt.Errorf("replay speed must not be negative")
+	}
+	if maxInFlight < 1 {
+		return nil, fmt.Errorf("replay needs at least 1 call in flight")
+	}
+
+	rec := newRecorder()
+	var (
+		wg       sync.WaitGroup
+		inFlight = make(chan struct{}, maxInFlight)
+		first    time.Time
+		readErr  error
+	)
+	start := time.Now()
+	for ctx.Err() == nil {
+		entry, err := r.Next()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				readErr = err
+			}
+			break
+		}
+
+		if speed > 0 {
+			if first.IsZero() {
+				first = entry.Time
+			}
+			at := start.Add(time.Duration(float64(entry.Time.Sub(first)) / speed))
+			select {
+			case <-ctx.Done():
+				continue
+			case <-time.After(time.Until(at)):
+			}
+		}
+
+		if speed == 0 {
+			select {
+			case <-ctx.Done():
+				continue
+			case inFlight <- struct{}{}:
+			}
+		} else {
+			select {
+			case inFlight <- struct{}{}:
+			default:
+				atomic.AddInt64(&rec.dropped, 1)
+				continue
+			}
+		}
+
+		wg.Add(1)
+		go func(entry *recording.Entry) {
+			defer wg.Done()
+			rec.record(func(ctx context.Context) error {
+				err := call(ctx, entry)
+				if ctx.Err() == nil && status.Code(err).String() != entry.Code {
+					atomic.AddInt64(&rec.mismatched, 1)
+				}
+				return err
+			})(ctx)
+			<-inFlight
+		}(entry)
+	}
+	wg.Wait()
+
+	if readErr != nil {
+		return nil, readErr
+	}
+	return rec.report(Replay, time.Since(start)), nil
+}
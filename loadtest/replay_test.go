@@ -0,0 +1,52 @@
+package loadtest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jamiewhitney/grpc-go-vault/recording"
+)
+
+func TestRunReplay(t *testing.T) {
+	recorded := `{"time":"2026-10-19T12:00:00Z","method":"/hello.v1.HelloService/SayHello","request":{"name":"a"},"code":"OK"}
+{"time":"2026-10-19T12:00:00.1Z","method":"/hello.v1.HelloService/SayHello","request":{"name":"b"},"code":"OK"}
+{"time":"2026-10-19T12:00:00.2Z","method":"/hello.v1.HelloService/SayHello","request":{"name":"c"},"code":"NotFound"}
+`
+	call := func(ctx context.Context, entry *recording.Entry) error {
+		return nil
+	}
+
+	tests := []struct {
+		speed   float64
+		minTime time.Duration
+		maxTime time.Duration
+	}{
+		{1, 200 * time.Millisecond, 300 * time.Millisecond},
+		{2, 100 * time.Millisecond, 200 * time.Millisecond},
+		{0, 0, 50 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		start := time.Now()
+		report, err := RunReplay(context.Background(), recording.NewReader(strings.NewReader(recorded)), tt.speed, 10, call)
+		elapsed := time.Since(start)
+		if err != nil {
+			t.Fatalf("RunReplay() at speed %v got unexpected error: %v", tt.speed, err)
+		}
+		if elapsed < tt.minTime || elapsed > tt.maxTime {
+			t.Errorf("RunReplay() at speed %v took %s, wanted between %s and %s", tt.speed, elapsed, tt.minTime, tt.maxTime)
+		}
+		if report.Requests != 3 || report.Codes["OK"] != 3 {
+			t.Errorf("RunReplay() at speed %v got %d requests with codes %v, wanted 3 OK", tt.speed, report.Requests, report.Codes)
+		}
+		if report.Mismatched != 1 {
+			t.Errorf("RunReplay() at speed %v got %d mismatched, wanted 1", tt.speed, report.Mismatched)
+		}
+	}
+
+	if _, err := RunReplay(context.Background(), recording.NewReader(strings.NewReader("oops\n")), 0, 1, call); err == nil {
+		t.Errorf("RunReplay() of an invalid recording got no error")
+	}
+}
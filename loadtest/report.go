@@ -0,0 +1,116 @@
+package loadtest
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// bucketGrowth is the ratio between the bounds of consecutive histogram
+// buckets, so that percentiles are accurate to within 1%.
+const bucketGrowth = 1.01
+
+// histogram counts latencies in exponentially growing buckets, keeping memory
+// constant however long the run.
+type histogram struct {
+	counts []int64
+	total  int64
+	max    time.Duration
+}
+
+func bucket(d time.Duration) int {
+	if d < time.Microsecond {
+		return 0
+	}
+	return int(math.Log(float64(d/time.Microsecond))/math.Log(bucketGrowth)) + 1
+}
+
+// upperBound returns the largest latency counted in bucket i.
+func upperBound(i int) time.Duration {
+	if i == 0 {
+		return time.Microsecond
+	}
+	return time.Duration(math.Pow(bucketGrowth, float64(i))) * time.Microsecond
+}
+
+func (h *histogram) add(d time.Duration) {
+	i := bucket(d)
+	for len(h.counts) <= i {
+		h.counts = append(h.counts, 0)
+	}
+	h.counts[i]++
+	h.total++
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// quantile returns the latency below which the fraction q of calls fell.
+func (h *histogram) quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(h.total)))
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			if b := upperBound(i); b < h.max {
+				return b
+			}
+			return h.max
+		}
+	}
+	return h.max
+}
+
+// Report summarises a run. Latencies are in milliseconds. Mismatched counts
+// replayed calls that ended with a different status code than recorded.
+type Report struct {
+	Mode       string           `json:"mode"`
+	Duration   float64          `json:"duration_seconds"`
+	Requests   int64            `json:"requests"`
+	Throughput float64          `json:"requests_per_second"`
+	Dropped    int64            `json:"dropped"`
+	Mismatched int64            `json:"mismatched,omitempty"`
+	P50        float64          `json:"latency_p50_ms"`
+	P90        float64          `json:"latency_p90_ms"`
+	P95        float64          `json:"latency_p95_ms"`
+	P99        float64          `json:"latency_p99_ms"`
+	Max        float64          `json:"latency_max_ms"`
+	Codes      map[string]int64 `json:"codes"`
+}
+
+func (r *recorder) report(mode string, elapsed time.Duration) *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	codes := make(map[string]int64, len(r.codes))
+	for code, n := range r.codes {
+		codes[code] = n
+	}
+	h := &r.latencies
+	return &Report{
+		Mode:       mode,
+		Duration:   round(elapsed.Seconds()),
+		Requests:   h.total,
+		Throughput: round(float64(h.total) / elapsed.Seconds()),
+		Dropped:    atomic.LoadInt64(&r.dropped),
+		Mismatched: atomic.LoadInt64(&r.mismatched),
+		P50:        millis(h.quantile(0.5)),
+		P90:        millis(h.quantile(0.9)),
+		P95:        millis(h.quantile(0.95)),
+		P99:        millis(h.quantile(0.99)),
+		Max:        millis(h.max),
+		Codes:      codes,
+	}
+}
+
+func millis(d time.Duration) float64 {
+	return round(float64(d) / float64(time.Millisecond))
+}
+
+// round rounds x to two decimal places for display.
+func round(x float64) float64 {
+	return math.Round(x*100) / 100
+}
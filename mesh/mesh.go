@@ -0,0 +1,42 @@
+// Package mesh lets the server join a proxyless gRPC service mesh, taking its
+// listener configuration from the xDS control plane named in the bootstrap
+// file at GRPC_XDS_BOOTSTRAP. Vault-issued certificates remain the identity
+// of both sides: the server keeps the transport credentials it is given
+// rather than taking certificates from the control plane.
+package mesh
+
+import (
+	"net"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/xds"
+)
+
+// Server is the part of grpc.Server an xDS-enabled server provides as well.
+type Server interface {
+	grpc.ServiceRegistrar
+	GetServiceInfo() map[string]grpc.ServiceInfo
+	Serve(lis net.Listener) error
+	Stop()
+	GracefulStop()
+}
+
+// NewServer returns an xDS-enabled server if enabled is set and a plain
+// grpc.Server otherwise. An xDS-enabled server only accepts connections on a
+// listener once the control plane has sent a Listener resource for its
+// address; every change of serving mode is logged.
+func NewServer(log logrus.FieldLogger, enabled bool, opts ...grpc.ServerOption) Server {
+	if !enabled {
+		return grpc.NewServer(opts...)
+	}
+
+	opts = append(opts, xds.ServingModeCallback(func(addr net.Addr, args xds.ServingModeChangeArgs) {
+		entry := log.WithField("addr", addr.String())
+		if args.Err != nil {
+			entry = entry.WithError(args.Err)
+		}
+		entry.Infof("xDS serving mode changed to %s", args.Mode)
+	}))
+	return xds.NewGRPCServer(opts...)
+}
@@ -0,0 +1,231 @@
+package mesh
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	clusterpb "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpointpb "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	listenerpb "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	routepb "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	routerpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/router/v3"
+	hcmpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	discoverypb "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	xdsserver "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	pb "github.com/jamiewhitney/grpc-go-vault/hello/v1"
+	"github.com/jamiewhitney/grpc-go-vault/internal/testutil"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/xds"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	nodeID                 = "test-node"
+	serverListenerTemplate = "grpc/server?xds.resource.listening_address=%s"
+)
+
+func TestNewServerPlain(t *testing.T) {
+	if _, ok := NewServer(logrus.New(), false).(*grpc.Server); !ok {
+		t.Errorf("NewServer() without xDS did not return a *grpc.Server")
+	}
+}
+
+// TestXDS serves HelloService from an xDS-enabled server and calls it through
+// an xds:/// target, with both sides configured by a local control plane.
+func TestXDS(t *testing.T) {
+	snapshots, controlPlane := startControlPlane(t)
+	bootstrap := []byte(fmt.Sprintf(`{
+		"xds_servers": [{
+			"server_uri": %q,
+			"channel_creds": [{"type": "insecure"}],
+			"server_features": ["xds_v3"]
+		}],
+		"node": {"id": %q},
+		"server_listener_resource_name_template": %q
+	}`, controlPlane, nodeID, serverListenerTemplate))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := uint32(lis.Addr().(*net.TCPAddr).Port)
+
+	s := NewServer(logrus.New(), true, grpc.Creds(insecure.NewCredentials()), xds.BootstrapContentsForTesting(bootstrap))
+	pb.RegisterHelloServiceServer(s, &testutil.HelloServer{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	snapshot, err := cache.NewSnapshot("1", map[resource.Type][]types.Resource{
+		resource.ListenerType: {serverListener(t, "127.0.0.1", port), clientListener(t, "hello", "hello-route")},
+		resource.RouteType:    {routeConfig("hello-route", "hello", "hello-cluster")},
+		resource.ClusterType:  {edsCluster("hello-cluster")},
+		resource.EndpointType: {endpoints("hello-cluster", "127.0.0.1", port)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshots.SetSnapshot(context.Background(), nodeID, snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	resolver, err := xds.NewXDSResolverWithConfigForTesting(bootstrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := grpc.Dial("xds:///hello", grpc.WithResolvers(resolver), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("did not connect: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := pb.NewHelloServiceClient(conn).SayHello(ctx, &pb.HelloRequest{Name: "mesh"}, grpc.WaitForReady(true))
+	if err != nil {
+		t.Fatalf("SayHello() got unexpected error: %v", err)
+	}
+	if want := "Hello mesh"; resp.GetGreeting() != want {
+		t.Errorf("SayHello() got %q, wanted %q", resp.GetGreeting(), want)
+	}
+}
+
+// startControlPlane serves ADS from a snapshot cache on a local port.
+func startControlPlane(t *testing.T) (cache.SnapshotCache, string) {
+	t.Helper()
+
+	snapshots := cache.NewSnapshotCache(true, cache.IDHash{}, nil)
+	s := grpc.NewServer()
+	discoverypb.RegisterAggregatedDiscoveryServiceServer(s, xdsserver.NewServer(context.Background(), snapshots, nil))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return snapshots, lis.Addr().String()
+}
+
+func marshalAny(t *testing.T, m proto.Message) *anypb.Any {
+	t.Helper()
+
+	a, err := anypb.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func routerFilter(t *testing.T) *hcmpb.HttpFilter {
+	return &hcmpb.HttpFilter{
+		Name:       "router",
+		ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: marshalAny(t, &routerpb.Router{})},
+	}
+}
+
+// serverListener admits every call on host:port.
+func serverListener(t *testing.T, host string, port uint32) *listenerpb.Listener {
+	hcm := &hcmpb.HttpConnectionManager{
+		RouteSpecifier: &hcmpb.HttpConnectionManager_RouteConfig{RouteConfig: &routepb.RouteConfiguration{
+			Name: "server-route",
+			VirtualHosts: []*routepb.VirtualHost{{
+				Domains: []string{"*"},
+				Routes: []*routepb.Route{{
+					Match:  &routepb.RouteMatch{PathSpecifier: &routepb.RouteMatch_Prefix{Prefix: "/"}},
+					Action: &routepb.Route_NonForwardingAction{},
+				}},
+			}},
+		}},
+		HttpFilters: []*hcmpb.HttpFilter{routerFilter(t)},
+	}
+	return &listenerpb.Listener{
+		Name: fmt.Sprintf(serverListenerTemplate, net.JoinHostPort(host, strconv.Itoa(int(port)))),
+		Address: &corepb.Address{Address: &corepb.Address_SocketAddress{SocketAddress: &corepb.SocketAddress{
+			Address:       host,
+			PortSpecifier: &corepb.SocketAddress_PortValue{PortValue: port},
+		}}},
+		FilterChains: []*listenerpb.FilterChain{{
+			Name: "v4-wildcard",
+			FilterChainMatch: &listenerpb.FilterChainMatch{
+				PrefixRanges: []*corepb.CidrRange{{AddressPrefix: "0.0.0.0", PrefixLen: wrapperspb.UInt32(0)}},
+				SourceType:   listenerpb.FilterChainMatch_SAME_IP_OR_LOOPBACK,
+			},
+			Filters: []*listenerpb.Filter{{
+				Name:       "hcm",
+				ConfigType: &listenerpb.Filter_TypedConfig{TypedConfig: marshalAny(t, hcm)},
+			}},
+		}},
+	}
+}
+
+// clientListener routes calls to xds:///target through the named route.
+func clientListener(t *testing.T, target, route string) *listenerpb.Listener {
+	hcm := marshalAny(t, &hcmpb.HttpConnectionManager{
+		RouteSpecifier: &hcmpb.HttpConnectionManager_Rds{Rds: &hcmpb.Rds{
+			ConfigSource:    &corepb.ConfigSource{ConfigSourceSpecifier: &corepb.ConfigSource_Ads{Ads: &corepb.AggregatedConfigSource{}}},
+			RouteConfigName: route,
+		}},
+		HttpFilters: []*hcmpb.HttpFilter{routerFilter(t)},
+	})
+	return &listenerpb.Listener{
+		Name:        target,
+		ApiListener: &listenerpb.ApiListener{ApiListener: hcm},
+	}
+}
+
+func routeConfig(name, target, cluster string) *routepb.RouteConfiguration {
+	return &routepb.RouteConfiguration{
+		Name: name,
+		VirtualHosts: []*routepb.VirtualHost{{
+			Domains: []string{target},
+			Routes: []*routepb.Route{{
+				Match: &routepb.RouteMatch{PathSpecifier: &routepb.RouteMatch_Prefix{Prefix: "/"}},
+				Action: &routepb.Route_Route{Route: &routepb.RouteAction{
+					ClusterSpecifier: &routepb.RouteAction_Cluster{Cluster: cluster},
+				}},
+			}},
+		}},
+	}
+}
+
+func edsCluster(name string) *clusterpb.Cluster {
+	return &clusterpb.Cluster{
+		Name:                 name,
+		ClusterDiscoveryType: &clusterpb.Cluster_Type{Type: clusterpb.Cluster_EDS},
+		EdsClusterConfig: &clusterpb.Cluster_EdsClusterConfig{
+			EdsConfig: &corepb.ConfigSource{ConfigSourceSpecifier: &corepb.ConfigSource_Ads{Ads: &corepb.AggregatedConfigSource{}}},
+		},
+		LbPolicy: clusterpb.Cluster_ROUND_ROBIN,
+	}
+}
+
+func endpoints(cluster, host string, port uint32) *endpointpb.ClusterLoadAssignment {
+	return &endpointpb.ClusterLoadAssignment{
+		ClusterName: cluster,
+		Endpoints: []*endpointpb.LocalityLbEndpoints{{
+			Locality: &corepb.Locality{SubZone: "local"},
+			LbEndpoints: []*endpointpb.LbEndpoint{{
+				HostIdentifier: &endpointpb.LbEndpoint_Endpoint{Endpoint: &endpointpb.Endpoint{
+					Address: &corepb.Address{Address: &corepb.Address_SocketAddress{SocketAddress: &corepb.SocketAddress{
+						Protocol:      corepb.SocketAddress_TCP,
+						Address:       host,
+						PortSpecifier: &corepb.SocketAddress_PortValue{PortValue: port},
+					}}},
+				}},
+			}},
+			LoadBalancingWeight: wrapperspb.UInt32(1),
+		}},
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+
+	auth "github.com/jamiewhitney/auth-jwt-grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+var errMissingBearerToken = Status(codes.Unauthenticated, "missing bearer token", ReasonInvalidToken, nil).Err()
+
+// UnaryAuthorizer returns an interceptor admitting only calls whose bearer
+// token a accepts. Rejected calls fail with codes.Unauthenticated and an
+// INVALID_TOKEN ErrorInfo in place of the authorizer's bare statuses.
+//
+// The token is parsed and its claims checked here, as a.EnsureValidToken
+// does, rather than by calling it: it panics on calls without a token it can
+// parse, and would verify the signature a second time.
+func UnaryAuthorizer(a *auth.Authorizer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		authorization := md.Get("authorization")
+		if len(authorization) == 0 {
+			return nil, errMissingBearerToken
+		}
+		token, claims, err := a.ParseToken(authorization)
+		if err != nil || !token.Valid {
+			return nil, errInvalidBearerToken
+		}
+		if msg := rejectClaims(a, claims); msg != "" {
+			return nil, Status(codes.Unauthenticated, msg, ReasonInvalidToken, nil).Err()
+		}
+		return handler(ctx, req)
+	}
+}
+
+// rejectClaims returns why a rejects a token with claims, in the words of
+// a.EnsureValidToken, or "" if it accepts it.
+func rejectClaims(a *auth.Authorizer, claims *auth.MyCustomClaims) string {
+	switch {
+	case !claims.HasScope(a.Scope):
+		return "invalid scope"
+	case !claims.VerifyAudience(a.Audience, true):
+		return "invalid audience"
+	case !claims.VerifyIssuer(a.Issuer, true):
+		return "invalid issuer"
+	case claims.Subject != a.Subject:
+		return "invalid subject"
+	}
+	return ""
+}
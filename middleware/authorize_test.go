@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/jamiewhitney/grpc-go-vault/hello/v1"
+	"github.com/jamiewhitney/grpc-go-vault/internal/testutil"
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryAuthorizer(t *testing.T) {
+	log, hook := test.NewNullLogger()
+	c := testutil.DialHello(t, grpc.ChainUnaryInterceptor(UnaryRecovery(log, nil), UnaryAuthorizer(testutil.Authorizer())))
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          codes.Code
+	}{
+		{"valid token", testutil.Token(t, testutil.Subject), codes.OK},
+		{"missing token", "", codes.Unauthenticated},
+		{"malformed token", "Bearer nonsense", codes.Unauthenticated},
+		{"wrong subject", testutil.Token(t, "someone@clients"), codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.authorization != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", tt.authorization)
+		}
+		_, err := c.SayHello(ctx, &pb.HelloRequest{Name: "world"})
+		if got := status.Code(err); got != tt.want {
+			t.Errorf("%s: SayHello() got code %s, wanted %s", tt.name, got, tt.want)
+			continue
+		}
+		if tt.want == codes.OK {
+			continue
+		}
+		details := status.Convert(err).Details()
+		if len(details) == 0 || details[0].(*errdetails.ErrorInfo).GetReason() != ReasonInvalidToken {
+			t.Errorf("%s: SayHello() got details %v, wanted reason %s", tt.name, details, ReasonInvalidToken)
+		}
+	}
+	if len(hook.AllEntries()) != 0 {
+		t.Errorf("UnaryAuthorizer() panicked: %v", hook.LastEntry().Data["panic"])
+	}
+}
+
+func TestUnaryAuthorizerPassesHandlerErrors(t *testing.T) {
+	interceptor := UnaryAuthorizer(testutil.Authorizer())
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", testutil.Token(t, testutil.Subject)))
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "no such user")
+	}
+
+	_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("UnaryAuthorizer() got error %v, wanted the handler's", err)
+	}
+}
@@ -0,0 +1,213 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jamiewhitney/grpc-go-vault/config"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// CircuitState is the state of one circuit.
+type CircuitState int
+
+const (
+	// CircuitClosed lets every call through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails every call until the open timeout has passed.
+	CircuitOpen
+	// CircuitHalfOpen lets one trial call through at a time.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker stops a client calling a degraded server. Each target and
+// method has its own circuit, which opens after a run of consecutive
+// failures, fails calls locally while open, and after the open timeout lets
+// trial calls through one at a time until enough succeed in a row to close
+// it again. Only errors suggesting the server is unhealthy count as
+// failures; a rejected request says nothing about the server.
+type CircuitBreaker struct {
+	cfg  config.CircuitBreaker
+	app  *newrelic.Application
+	logf func(format string, args ...interface{})
+	now  func() time.Time
+
+	mu       sync.Mutex
+	circuits map[circuitKey]*circuit
+}
+
+type circuitKey struct {
+	target string
+	method string
+}
+
+type circuit struct {
+	state     CircuitState
+	failures  int
+	successes int
+	openedAt  time.Time
+	trial     bool
+}
+
+// NewCircuitBreaker creates a CircuitBreaker logging state changes with logf.
+func NewCircuitBreaker(cfg config.CircuitBreaker, app *newrelic.Application, logf func(format string, args ...interface{})) *CircuitBreaker {
+	return &CircuitBreaker{
+		cfg:      cfg,
+		app:      app,
+		logf:     logf,
+		now:      time.Now,
+		circuits: make(map[circuitKey]*circuit),
+	}
+}
+
+// Unary returns a client interceptor failing calls on an open circuit with
+// codes.Unavailable and a RetryInfo detail saying when to try again.
+func (b *CircuitBreaker) Unary() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if b.cfg.FailureThreshold == 0 {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		key := circuitKey{target: cc.Target(), method: method}
+		trial, err := b.allow(key)
+		if err != nil {
+			return err
+		}
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		b.record(key, trial, err)
+		return err
+	}
+}
+
+// State returns the state of the circuit for method on target.
+func (b *CircuitBreaker) State(target, method string) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c, ok := b.circuits[circuitKey{target: target, method: method}]; ok {
+		return c.state
+	}
+	return CircuitClosed
+}
+
+// allow reports whether a call may go ahead on the circuit for key, and
+// whether it is the trial call of a half-open circuit.
+func (b *CircuitBreaker) allow(key circuitKey) (trial bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{}
+		b.circuits[key] = c
+	}
+
+	now := b.now()
+	if c.state == CircuitOpen {
+		if wait := c.openedAt.Add(b.cfg.OpenTimeout).Sub(now); wait > 0 {
+			return false, b.reject(key, wait)
+		}
+		b.transition(key, c, CircuitHalfOpen)
+	}
+	if c.state == CircuitHalfOpen {
+		if c.trial {
+			return false, b.reject(key, 0)
+		}
+		c.trial = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// record counts the result of a call let through by allow. Only the trial
+// call settles a half-open circuit: a call let through before the circuit
+// opened may still finish after it has turned half-open.
+func (b *CircuitBreaker) record(key circuitKey, trial bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuits[key]
+	failed := tripsCircuit(status.Code(err))
+	switch c.state {
+	case CircuitClosed:
+		if !failed {
+			c.failures = 0
+			return
+		}
+		c.failures++
+		if c.failures >= b.cfg.FailureThreshold {
+			b.open(key, c)
+		}
+	case CircuitHalfOpen:
+		if !trial {
+			return
+		}
+		c.trial = false
+		if failed {
+			b.open(key, c)
+			return
+		}
+		c.successes++
+		if c.successes >= b.cfg.HalfOpenSuccesses {
+			c.failures, c.successes = 0, 0
+			b.transition(key, c, CircuitClosed)
+		}
+	}
+}
+
+func (b *CircuitBreaker) open(key circuitKey, c *circuit) {
+	c.openedAt = b.now()
+	c.successes = 0
+	b.transition(key, c, CircuitOpen)
+}
+
+func (b *CircuitBreaker) transition(key circuitKey, c *circuit, to CircuitState) {
+	from := c.state
+	c.state = to
+	b.logf("circuit breaker for %s on %s changed from %s to %s", key.method, key.target, from, to)
+	switch to {
+	case CircuitOpen:
+		b.app.RecordCustomMetric("CircuitOpened", 1)
+	case CircuitHalfOpen:
+		b.app.RecordCustomMetric("CircuitHalfOpened", 1)
+	case CircuitClosed:
+		b.app.RecordCustomMetric("CircuitClosed", 1)
+	}
+}
+
+func (b *CircuitBreaker) reject(key circuitKey, wait time.Duration) error {
+	b.app.RecordCustomMetric("CircuitRejected", 1)
+	return Status(codes.Unavailable, "circuit breaker open", ReasonCircuitOpen,
+		map[string]string{"method": key.method, "target": key.target},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(wait)},
+	).Err()
+}
+
+// tripsCircuit reports whether a call ending with code suggests the server
+// is unhealthy. ResourceExhausted does not: the server rate limits each
+// caller separately, so it only says this client is calling too often.
+func tripsCircuit(code codes.Code) bool {
+	switch code {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown:
+		return true
+	}
+	return false
+}
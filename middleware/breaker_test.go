@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jamiewhitney/grpc-go-vault/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	conn, err := grpc.Dial("breaker-test", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var transitions []string
+	breaker := NewCircuitBreaker(config.CircuitBreaker{
+		FailureThreshold:  2,
+		OpenTimeout:       time.Minute,
+		HalfOpenSuccesses: 2,
+	}, nil, func(format string, args ...interface{}) {
+		transitions = append(transitions, args[3].(CircuitState).String())
+	})
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+	interceptor := breaker.Unary()
+
+	const method = "/hello.v1.HelloService/SayHello"
+	call := func(result codes.Code) (sent bool, code codes.Code) {
+		err := interceptor(context.Background(), method, nil, nil, conn, func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+			sent = true
+			return status.Error(result, "result")
+		})
+		return sent, status.Code(err)
+	}
+
+	tests := []struct {
+		name      string
+		advance   time.Duration
+		result    codes.Code
+		wantSent  bool
+		wantState CircuitState
+	}{
+		{"client error does not count", 0, codes.InvalidArgument, true, CircuitClosed},
+		{"rate limiting does not count", 0, codes.ResourceExhausted, true, CircuitClosed},
+		{"first failure", 0, codes.Unavailable, true, CircuitClosed},
+		{"threshold opens", 0, codes.Unavailable, true, CircuitOpen},
+		{"open fails fast", 0, codes.OK, false, CircuitOpen},
+		{"timeout lets a trial through", time.Minute, codes.OK, true, CircuitHalfOpen},
+		{"failed trial reopens", 0, codes.DeadlineExceeded, true, CircuitOpen},
+		{"second trial", time.Minute, codes.OK, true, CircuitHalfOpen},
+		{"enough successes close", 0, codes.OK, true, CircuitClosed},
+	}
+	for _, tt := range tests {
+		now = now.Add(tt.advance)
+		sent, code := call(tt.result)
+		if sent != tt.wantSent {
+			t.Errorf("%s: call sent %t, wanted %t", tt.name, sent, tt.wantSent)
+		}
+		if !sent && code != codes.Unavailable {
+			t.Errorf("%s: rejected call got code %s, wanted %s", tt.name, code, codes.Unavailable)
+		}
+		if got := breaker.State(conn.Target(), method); got != tt.wantState {
+			t.Errorf("%s: got state %s, wanted %s", tt.name, got, tt.wantState)
+		}
+	}
+
+	want := []string{"open", "half-open", "open", "half-open", "closed"}
+	if len(transitions) != len(want) {
+		t.Fatalf("got transitions %v, wanted %v", transitions, want)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Errorf("got transitions %v, wanted %v", transitions, want)
+			break
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpenAllowsOneTrial(t *testing.T) {
+	conn, err := grpc.Dial("breaker-test", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	breaker := NewCircuitBreaker(config.CircuitBreaker{FailureThreshold: 1, OpenTimeout: time.Nanosecond, HalfOpenSuccesses: 1}, nil, func(string, ...interface{}) {})
+	key := circuitKey{target: conn.Target(), method: "/m"}
+	if _, err := breaker.allow(key); err != nil {
+		t.Fatal(err)
+	}
+	breaker.record(key, false, status.Error(codes.Unavailable, "down"))
+	time.Sleep(time.Millisecond)
+
+	if trial, err := breaker.allow(key); err != nil || !trial {
+		t.Fatalf("first trial got trial %t and error %v, wanted a trial", trial, err)
+	}
+	if _, err := breaker.allow(key); status.Code(err) != codes.Unavailable {
+		t.Errorf("concurrent trial got %v, wanted %s", err, codes.Unavailable)
+	}
+}
+
+// TestCircuitBreakerIgnoresStaleCalls finishes a call let through while the
+// circuit was closed after the trial call has started.
+func TestCircuitBreakerIgnoresStaleCalls(t *testing.T) {
+	conn, err := grpc.Dial("breaker-test", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	breaker := NewCircuitBreaker(config.CircuitBreaker{FailureThreshold: 1, OpenTimeout: time.Nanosecond, HalfOpenSuccesses: 1}, nil, func(string, ...interface{}) {})
+	key := circuitKey{target: conn.Target(), method: "/m"}
+	slow, err := breaker.allow(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := breaker.allow(key); err != nil {
+		t.Fatal(err)
+	}
+	breaker.record(key, false, status.Error(codes.Unavailable, "down"))
+	time.Sleep(time.Millisecond)
+	trial, err := breaker.allow(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	breaker.record(key, slow, nil)
+	if got := breaker.State(conn.Target(), "/m"); got != CircuitHalfOpen {
+		t.Errorf("stale call moved the circuit to %s, wanted %s", got, CircuitHalfOpen)
+	}
+	if _, err := breaker.allow(key); status.Code(err) != codes.Unavailable {
+		t.Errorf("call during the trial got %v, wanted %s", err, codes.Unavailable)
+	}
+
+	breaker.record(key, trial, nil)
+	if got := breaker.State(conn.Target(), "/m"); got != CircuitClosed {
+		t.Errorf("successful trial moved the circuit to %s, wanted %s", got, CircuitClosed)
+	}
+}
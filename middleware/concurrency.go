@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jamiewhitney/grpc-go-vault/config"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errOverloaded = Status(codes.Unavailable, "server overloaded, try again later", ReasonOverloaded, nil).Err()
+
+// ConcurrencyLimiter sheds requests once too many are in flight. The limit
+// adapts with AIMD: it grows by roughly one per limit's worth of requests
+// completing under the latency threshold while the limit is in use, and is
+// multiplied by the backoff ratio whenever a request is slower than the
+// threshold, runs out of deadline or panics.
+type ConcurrencyLimiter struct {
+	cfg config.Concurrency
+	app *newrelic.Application
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+	rejected uint64
+}
+
+// NewConcurrencyLimiter creates a ConcurrencyLimiter starting at the
+// configured initial limit.
+func NewConcurrencyLimiter(cfg config.Concurrency, app *newrelic.Application) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		cfg:   cfg,
+		app:   app,
+		limit: float64(cfg.InitialLimit),
+	}
+}
+
+// Unary returns an interceptor rejecting calls over the limit with
+// codes.Unavailable.
+func (l *ConcurrencyLimiter) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if l.cfg.MaxLimit == 0 {
+			return handler(ctx, req)
+		}
+		if !l.acquire(true) {
+			return nil, errOverloaded
+		}
+
+		// release in a defer so that a panic, recovered further up the
+		// chain, still frees the slot; it counts as a failure
+		start := time.Now()
+		failed := true
+		defer func() {
+			l.release(time.Since(start), failed)
+		}()
+		resp, err := handler(ctx, req)
+		failed = status.Code(err) == codes.DeadlineExceeded
+		return resp, err
+	}
+}
+
+// Stream returns an interceptor rejecting new streams with codes.Unavailable
+// while the limit is reached. Open streams take no slot and their duration is
+// no latency sample: they last as long as the client wants, health watches
+// for the life of the server, so neither says anything about load.
+func (l *ConcurrencyLimiter) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if l.cfg.MaxLimit != 0 && !l.acquire(false) {
+			return errOverloaded
+		}
+		return handler(srv, ss)
+	}
+}
+
+// Limit returns the current limit on requests in flight.
+func (l *ConcurrencyLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// Rejected returns the number of requests shed so far.
+func (l *ConcurrencyLimiter) Rejected() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rejected
+}
+
+// acquire reports whether a request may go ahead, taking a slot for it if
+// hold is set.
+func (l *ConcurrencyLimiter) acquire(hold bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inflight >= int(l.limit) {
+		l.rejected++
+		l.app.RecordCustomMetric("ConcurrencyRejected", 1)
+		return false
+	}
+	if hold {
+		l.inflight++
+	}
+	return true
+}
+
+func (l *ConcurrencyLimiter) release(latency time.Duration, failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	inflight := l.inflight
+	l.inflight--
+
+	previous := int(l.limit)
+	switch {
+	case failed || latency > l.cfg.LatencyThreshold:
+		l.limit = math.Max(l.limit*l.cfg.BackoffRatio, float64(l.cfg.MinLimit))
+	case inflight*2 >= previous:
+		// Only grow while the limit is actually being used, otherwise it
+		// drifts up to the maximum during quiet periods.
+		l.limit = math.Min(l.limit+1/l.limit, float64(l.cfg.MaxLimit))
+	}
+
+	if current := int(l.limit); current != previous {
+		l.app.RecordCustomMetric("ConcurrencyLimit", float64(current))
+	}
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jamiewhitney/grpc-go-vault/config"
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestConcurrencyLimiterSheds(t *testing.T) {
+	limiter := NewConcurrencyLimiter(config.Concurrency{
+		InitialLimit:     1,
+		MinLimit:         1,
+		MaxLimit:         1,
+		LatencyThreshold: time.Second,
+		BackoffRatio:     0.5,
+	}, nil)
+	interceptor := limiter.Unary()
+	info := &grpc.UnaryServerInfo{FullMethod: "/hello.v1.HelloService/SayHello"}
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			close(started)
+			<-unblock
+			return nil, nil
+		})
+		done <- err
+	}()
+	<-started
+
+	_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		t.Error("handler called over the limit")
+		return nil, nil
+	})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("interceptor got error %v, wanted code %s", err, codes.Unavailable)
+	}
+	if limiter.Rejected() != 1 {
+		t.Errorf("Rejected() got %d, wanted 1", limiter.Rejected())
+	}
+
+	opened := false
+	err = limiter.Stream()(nil, &serverStream{ctx: context.Background()}, &grpc.StreamServerInfo{}, func(srv interface{}, ss grpc.ServerStream) error {
+		opened = true
+		return nil
+	})
+	if opened || status.Code(err) != codes.Unavailable {
+		t.Errorf("stream interceptor got error %v and opened the stream: %t, wanted code %s", err, opened, codes.Unavailable)
+	}
+
+	close(unblock)
+	if err := <-done; err != nil {
+		t.Errorf("interceptor got unexpected error: %v", err)
+	}
+}
+
+func TestConcurrencyLimiterStreamsTakeNoSlot(t *testing.T) {
+	limiter := NewConcurrencyLimiter(config.Concurrency{
+		InitialLimit:     1,
+		MinLimit:         1,
+		MaxLimit:         1,
+		LatencyThreshold: time.Second,
+		BackoffRatio:     0.5,
+	}, nil)
+	info := &grpc.UnaryServerInfo{FullMethod: "/hello.v1.HelloService/SayHello"}
+
+	// a unary call must get through while the stream is open
+	err := limiter.Stream()(nil, &serverStream{ctx: context.Background()}, &grpc.StreamServerInfo{}, func(srv interface{}, ss grpc.ServerStream) error {
+		_, err := limiter.Unary()(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+		return err
+	})
+	if err != nil {
+		t.Errorf("unary call during a stream got error %v", err)
+	}
+	if limiter.Rejected() != 0 {
+		t.Errorf("Rejected() got %d, wanted 0", limiter.Rejected())
+	}
+}
+
+func TestConcurrencyLimiterAdapts(t *testing.T) {
+	limiter := NewConcurrencyLimiter(config.Concurrency{
+		InitialLimit:     1,
+		MinLimit:         1,
+		MaxLimit:         10,
+		LatencyThreshold: time.Second,
+		BackoffRatio:     0.5,
+	}, nil)
+	interceptor := limiter.Unary()
+	info := &grpc.UnaryServerInfo{FullMethod: "/hello.v1.HelloService/SayHello"}
+	fast := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	timedOut := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.DeadlineExceeded, "too slow")
+	}
+
+	for i := 0; i < 5; i++ {
+		interceptor(context.Background(), nil, info, fast)
+	}
+	grown := limiter.Limit()
+	if grown <= 1 {
+		t.Fatalf("Limit() got %d after fast requests, wanted it to grow", grown)
+	}
+
+	interceptor(context.Background(), nil, info, timedOut)
+	if got := limiter.Limit(); got >= grown {
+		t.Errorf("Limit() got %d after a timeout, wanted less than %d", got, grown)
+	}
+}
+
+func TestConcurrencyLimiterReleasesOnPanic(t *testing.T) {
+	limiter := NewConcurrencyLimiter(config.Concurrency{
+		InitialLimit:     2,
+		MinLimit:         2,
+		MaxLimit:         2,
+		LatencyThreshold: time.Second,
+		BackoffRatio:     0.5,
+	}, nil)
+	log, _ := test.NewNullLogger()
+	recovery, limit := UnaryRecovery(log, nil), limiter.Unary()
+	info := &grpc.UnaryServerInfo{FullMethod: "/hello.v1.HelloService/SayHello"}
+	// the server's order: recovery, then the limiter, then a panicking
+	// interceptor or handler
+	panics := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return limit(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			panic("nil token")
+		})
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := recovery(context.Background(), nil, info, panics); status.Code(err) != codes.Internal {
+			t.Fatalf("call %d got error %v, wanted code %s", i, err, codes.Internal)
+		}
+	}
+	if limiter.Rejected() != 0 {
+		t.Errorf("Rejected() got %d after panics, wanted 0", limiter.Rejected())
+	}
+}
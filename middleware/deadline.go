@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jamiewhitney/grpc-go-vault/config"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// UnaryClientDeadline returns a client interceptor giving calls made without
+// a deadline the one configured for their method, so that a hung server
+// cannot block the caller forever. The deadline covers every attempt of the
+// call, including retries and hedged attempts.
+func UnaryClientDeadline(cfg config.Deadlines) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := ctx.Deadline(); !ok {
+			timeout, ok := cfg.Methods[method]
+			if !ok {
+				timeout = cfg.Default
+			}
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// DeadlineLimiter caps the deadline calls are served with on the server. The
+// cap is set on the handler's context, so it also bounds any downstream call
+// made with that context.
+type DeadlineLimiter struct {
+	max time.Duration
+	app *newrelic.Application
+}
+
+// NewDeadlineLimiter creates a DeadlineLimiter serving calls for at most
+// cfg.Max.
+func NewDeadlineLimiter(cfg config.Deadlines, app *newrelic.Application) *DeadlineLimiter {
+	return &DeadlineLimiter{max: cfg.Max, app: app}
+}
+
+// Unary returns an interceptor cutting the deadline of calls arriving
+// without one, or with one further away than the maximum, short to the
+// maximum.
+func (l *DeadlineLimiter) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, cancel := l.limit(ctx)
+		defer cancel()
+		return handler(ctx, req)
+	}
+}
+
+// Stream is the streaming counterpart of Unary, bounding the lifetime of the
+// whole stream. Health watches are left alone: probes and load balancers keep
+// them open for as long as they follow the server.
+func (l *DeadlineLimiter) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if strings.HasPrefix(info.FullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/") {
+			return handler(srv, ss)
+		}
+		ctx, cancel := l.limit(ss.Context())
+		defer cancel()
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (l *DeadlineLimiter) limit(ctx context.Context) (context.Context, context.CancelFunc) {
+	if l.max <= 0 {
+		return ctx, func() {}
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= l.max {
+		return ctx, func() {}
+	}
+	l.app.RecordCustomMetric("DeadlineCapped", 1)
+	return context.WithTimeout(ctx, l.max)
+}
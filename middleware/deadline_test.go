@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jamiewhitney/grpc-go-vault/config"
+	"google.golang.org/grpc"
+)
+
+func TestUnaryClientDeadline(t *testing.T) {
+	interceptor := UnaryClientDeadline(config.Deadlines{
+		Default: 10 * time.Second,
+		Methods: map[string]time.Duration{
+			"/hello.v1.HelloService/SayHello": 2 * time.Second,
+			"/hello.v1.HelloService/Watch":    0,
+		},
+	})
+
+	tests := []struct {
+		method  string
+		timeout time.Duration
+		want    time.Duration
+	}{
+		{"/hello.v1.CreateUserService/CreateUser", 0, 10 * time.Second},
+		{"/hello.v1.HelloService/SayHello", 0, 2 * time.Second},
+		{"/hello.v1.HelloService/SayHello", time.Minute, time.Minute},
+		{"/hello.v1.HelloService/Watch", 0, 0},
+	}
+
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+			defer cancel()
+		}
+
+		var got time.Duration
+		invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			if deadline, ok := ctx.Deadline(); ok {
+				got = time.Until(deadline)
+			}
+			return nil
+		}
+		interceptor(ctx, tt.method, nil, nil, nil, invoker)
+
+		if got > tt.want || got < tt.want-time.Second {
+			t.Errorf("UnaryClientDeadline(%s) got deadline in %s, wanted %s", tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestDeadlineLimiter(t *testing.T) {
+	limiter := NewDeadlineLimiter(config.Deadlines{Max: 5 * time.Second}, nil)
+	interceptor := limiter.Unary()
+	info := &grpc.UnaryServerInfo{FullMethod: "/hello.v1.HelloService/SayHello"}
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		want    time.Duration
+	}{
+		{"no deadline", 0, 5 * time.Second},
+		{"later deadline", time.Minute, 5 * time.Second},
+		{"earlier deadline", time.Second, time.Second},
+	}
+
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+			defer cancel()
+		}
+
+		var got time.Duration
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			if deadline, ok := ctx.Deadline(); ok {
+				got = time.Until(deadline)
+			}
+			return nil, nil
+		}
+		interceptor(ctx, nil, info, handler)
+
+		if got > tt.want || got < tt.want-time.Second {
+			t.Errorf("%s: DeadlineLimiter got deadline in %s, wanted %s", tt.name, got, tt.want)
+		}
+	}
+
+	streams := []struct {
+		method string
+		want   time.Duration
+	}{
+		{"/hello.v1.HelloService/SayHello", 5 * time.Second},
+		{"/grpc.health.v1.Health/Watch", 0},
+	}
+	for _, tt := range streams {
+		var got time.Duration
+		handler := func(srv interface{}, ss grpc.ServerStream) error {
+			if deadline, ok := ss.Context().Deadline(); ok {
+				got = time.Until(deadline)
+			}
+			return nil
+		}
+		limiter.Stream()(nil, &serverStream{ctx: context.Background()}, &grpc.StreamServerInfo{FullMethod: tt.method}, handler)
+		if got > tt.want || got < tt.want-time.Second {
+			t.Errorf("DeadlineLimiter.Stream(%s) got deadline in %s, wanted %s", tt.method, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain is the ErrorInfo domain of every error raised by this service.
+const ErrorDomain = "grpc-go-vault.jamiewhitney.github.com"
+
+// ErrorInfo reasons, stable identifiers callers may switch on.
+const (
+	ReasonRateLimited         = "RATE_LIMITED"
+	ReasonOverloaded          = "OVERLOADED"
+	ReasonInvalidToken        = "INVALID_TOKEN"
+	ReasonInvalidRequest      = "INVALID_REQUEST"
+	ReasonCertificateRequired = "CLIENT_CERTIFICATE_REQUIRED"
+	ReasonInternal            = "INTERNAL"
+	ReasonUserExists          = "USER_EXISTS"
+	ReasonUserNotFound        = "USER_NOT_FOUND"
+	// ReasonCircuitOpen is raised by the client itself, for calls failed
+	// by an open circuit without being sent.
+	ReasonCircuitOpen = "CIRCUIT_OPEN"
+)
+
+// Status returns a status carrying an ErrorInfo for reason, followed by any
+// further details.
+func Status(code codes.Code, msg, reason string, metadata map[string]string, details ...proto.Message) *status.Status {
+	st := status.New(code, msg)
+	details = append([]proto.Message{&errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   ErrorDomain,
+		Metadata: metadata,
+	}}, details...)
+
+	withDetails, err := st.WithDetails(details...)
+	if err != nil {
+		return st
+	}
+	return withDetails
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"context"
+	"math/big"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// CallerIdentity identifies the caller of an RPC by the serial number of its
+// verified client certificate together with its IP address, or by its IP
+// address alone if it presented no certificate. Bearer tokens are not used:
+// every token the authorizer accepts carries the same subject, and an
+// unverified one could name another caller.
+//
+// Calls relayed by a trusted proxy, one whose certificate serial number is
+// among proxies, are identified by the client address the proxy appended to
+// x-forwarded-for instead. Only the last address is used, as any before it
+// came from the client.
+func CallerIdentity(ctx context.Context, proxies ...*big.Int) string {
+	pr, ok := peer.FromContext(ctx)
+	if !ok || pr.Addr == nil {
+		return "unknown"
+	}
+	host := pr.Addr.String()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	// Vault issues every certificate with its own serial number, while
+	// they all share the configured common name.
+	if tlsInfo, ok := pr.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.VerifiedChains) > 0 {
+		serial := tlsInfo.State.VerifiedChains[0][0].SerialNumber
+		for _, proxy := range proxies {
+			if serial.Cmp(proxy) == 0 {
+				if client := forwardedFor(ctx); client != "" {
+					return "ip:" + client
+				}
+			}
+		}
+		return "cert:" + serial.Text(16) + "@" + host
+	}
+	return "ip:" + host
+}
+
+// forwardedFor returns the last address in the x-forwarded-for metadata, or
+// "" if there is none.
+func forwardedFor(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("x-forwarded-for")
+	if len(values) == 0 {
+		return ""
+	}
+	addrs := strings.Split(values[len(values)-1], ",")
+	ip := net.ParseIP(strings.TrimSpace(addrs[len(addrs)-1]))
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
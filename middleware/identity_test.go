@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"testing"
+
+	"github.com/jamiewhitney/grpc-go-vault/internal/testutil"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestCallerIdentity(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}
+	withCert := func(serial int64) credentials.AuthInfo {
+		cert := &x509.Certificate{SerialNumber: big.NewInt(serial)}
+		return credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}}
+	}
+
+	proxy := big.NewInt(0xf00)
+
+	tests := []struct {
+		name      string
+		peer      *peer.Peer
+		forwarded []string
+		want      string
+	}{
+		{"no peer", nil, nil, "unknown"},
+		{"no certificate", &peer.Peer{Addr: addr}, nil, "ip:10.0.0.1"},
+		{"certificate", &peer.Peer{Addr: addr, AuthInfo: withCert(0xabc)}, nil, "cert:abc@10.0.0.1"},
+		{"unverified certificate", &peer.Peer{Addr: addr, AuthInfo: credentials.TLSInfo{}}, nil, "ip:10.0.0.1"},
+		{"forwarded by untrusted caller", &peer.Peer{Addr: addr, AuthInfo: withCert(0xabc)}, []string{"192.0.2.1"}, "cert:abc@10.0.0.1"},
+		{"forwarded by proxy", &peer.Peer{Addr: addr, AuthInfo: withCert(0xf00)}, []string{"192.0.2.1"}, "ip:192.0.2.1"},
+		{"forwarded chain", &peer.Peer{Addr: addr, AuthInfo: withCert(0xf00)}, []string{"spoofed", "198.51.100.1, 192.0.2.1"}, "ip:192.0.2.1"},
+		{"proxy without forwarded address", &peer.Peer{Addr: addr, AuthInfo: withCert(0xf00)}, nil, "cert:f00@10.0.0.1"},
+	}
+	for _, tt := range tests {
+		// the token's subject must not be trusted
+		md := metadata.Pairs("authorization", testutil.Token(t, "someone"))
+		md.Append("x-forwarded-for", tt.forwarded...)
+		ctx := metadata.NewIncomingContext(context.Background(), md)
+		if tt.peer != nil {
+			ctx = peer.NewContext(ctx, tt.peer)
+		}
+		if got := CallerIdentity(ctx, proxy); got != tt.want {
+			t.Errorf("%s: CallerIdentity() got %q, wanted %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jamiewhitney/grpc-go-vault/config"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// idleBucketTTL is how long a caller's bucket is kept after its last request.
+// Any bucket idle for this long has refilled, so dropping it is harmless.
+const idleBucketTTL = 5 * time.Minute
+
+// RateLimiter gives every caller, as identified by CallerIdentity, a token
+// bucket per rate-limited method.
+type RateLimiter struct {
+	limits  config.RateLimit
+	proxies []*big.Int
+	app     *newrelic.Application
+
+	mu        sync.Mutex
+	buckets   map[bucketKey]*bucket
+	lastSweep time.Time
+}
+
+type bucketKey struct {
+	caller string
+	method string
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewRateLimiter creates a RateLimiter enforcing limits. Calls relayed by the
+// proxies holding certificates with the serial numbers in proxies, such as the
+// REST gateway, are limited per client they forward.
+func NewRateLimiter(limits config.RateLimit, proxies []*big.Int, app *newrelic.Application) *RateLimiter {
+	return &RateLimiter{
+		limits:    limits,
+		proxies:   proxies,
+		app:       app,
+		buckets:   make(map[bucketKey]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Unary returns an interceptor rejecting calls over the limit with
+// codes.ResourceExhausted.
+func (l *RateLimiter) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := l.allow(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Stream returns an interceptor applying the limit when a stream is opened.
+func (l *RateLimiter) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := l.allow(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func (l *RateLimiter) allow(ctx context.Context, fullMethod string) error {
+	method := fullMethod
+	limit, ok := l.limits.Methods[method]
+	if !ok {
+		limit = l.limits.Default
+		// Methods without their own limit share the caller's default bucket.
+		method = ""
+	}
+	if limit.Rate <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	caller := CallerIdentity(ctx, l.proxies...)
+	limiter := l.limiter(bucketKey{caller: caller, method: method}, limit, now)
+
+	r := limiter.ReserveN(now, 1)
+	delay := r.DelayFrom(now)
+	if delay == 0 {
+		return nil
+	}
+	r.CancelAt(now)
+
+	l.app.RecordCustomMetric("RateLimited", 1)
+	retryAfter := strconv.Itoa(int(math.Ceil(delay.Seconds())))
+	grpc.SetTrailer(ctx, metadata.Pairs("retry-after", retryAfter))
+	return Status(codes.ResourceExhausted, fmt.Sprintf("rate limit exceeded, retry after %ss", retryAfter), ReasonRateLimited,
+		map[string]string{"method": fullMethod},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)},
+		&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{{
+			Subject:     caller,
+			Description: fmt.Sprintf("limited to %g requests per second with a burst of %d", limit.Rate, limit.Burst),
+		}}},
+	).Err()
+}
+
+func (l *RateLimiter) limiter(key bucketKey, limit config.Limit, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > idleBucketTTL {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > idleBucketTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	return b.limiter
+}
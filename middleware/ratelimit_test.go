@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/jamiewhitney/grpc-go-vault/config"
+	pb "github.com/jamiewhitney/grpc-go-vault/hello/v1"
+	"github.com/jamiewhitney/grpc-go-vault/internal/testutil"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// withPeer asks fakePeer to serve the call as if it came from ip.
+func withPeer(ctx context.Context, ip string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "test-peer", ip)
+}
+
+// fakePeer replaces the peer of calls made through withPeer, as every call
+// over bufconn comes from the same address.
+func fakePeer(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if ip := md.Get("test-peer"); len(ip) > 0 {
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip[0]), Port: 1234}})
+	}
+	return handler(ctx, req)
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(config.RateLimit{
+		Default: config.Limit{Rate: 0.001, Burst: 2},
+		Methods: map[string]config.Limit{
+			"/hello.v1.HelloService/SayHello": {Rate: 0.001, Burst: 1},
+		},
+	}, nil, nil)
+	c := testutil.DialHello(t, grpc.ChainUnaryInterceptor(fakePeer, limiter.Unary()))
+
+	tests := []struct {
+		ip   string
+		want codes.Code
+	}{
+		{"10.0.0.1", codes.OK},
+		{"10.0.0.1", codes.ResourceExhausted},
+		{"10.0.0.2", codes.OK},
+	}
+
+	for _, tt := range tests {
+		var trailer metadata.MD
+		ctx := withPeer(context.Background(), tt.ip)
+		_, err := c.SayHello(ctx, &pb.HelloRequest{Name: "world"}, grpc.Trailer(&trailer))
+		if got := status.Code(err); got != tt.want {
+			t.Errorf("SayHello(%s) got code %s, wanted %s", tt.ip, got, tt.want)
+		}
+		if tt.want == codes.ResourceExhausted && len(trailer.Get("retry-after")) == 0 {
+			t.Errorf("SayHello(%s) got no retry-after trailer", tt.ip)
+		}
+	}
+}
+
+func TestRateLimiterErrorDetails(t *testing.T) {
+	limiter := NewRateLimiter(config.RateLimit{Default: config.Limit{Rate: 0.001, Burst: 1}}, nil, nil)
+	c := testutil.DialHello(t, grpc.ChainUnaryInterceptor(fakePeer, limiter.Unary()))
+
+	ctx := withPeer(context.Background(), "10.0.0.1")
+	c.SayHello(ctx, &pb.HelloRequest{Name: "world"})
+	_, err := c.SayHello(ctx, &pb.HelloRequest{Name: "world"})
+
+	var info *errdetails.ErrorInfo
+	var retry *errdetails.RetryInfo
+	var quota *errdetails.QuotaFailure
+	for _, detail := range status.Convert(err).Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			info = d
+		case *errdetails.RetryInfo:
+			retry = d
+		case *errdetails.QuotaFailure:
+			quota = d
+		}
+	}
+
+	if info.GetReason() != ReasonRateLimited || info.GetDomain() != ErrorDomain {
+		t.Errorf("SayHello() got ErrorInfo %v, wanted reason %s in %s", info, ReasonRateLimited, ErrorDomain)
+	}
+	if retry.GetRetryDelay().AsDuration() <= 0 {
+		t.Errorf("SayHello() got RetryInfo %v, wanted a positive delay", retry)
+	}
+	if got := quota.GetViolations(); len(got) != 1 || got[0].GetSubject() != "ip:10.0.0.1" {
+		t.Errorf("SayHello() got QuotaFailure %v, wanted one violation for ip:10.0.0.1", quota)
+	}
+}
@@ -0,0 +1,78 @@
+// Package middleware contains the gRPC interceptors shared by the server and
+// client binaries.
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strings"
+
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// errPanic is returned to callers in place of the panic value so that no
+// internals leak out of the server.
+var errPanic = Status(codes.Internal, "internal error", ReasonInternal, nil).Err()
+
+// UnaryRecovery returns an interceptor that turns a panic in the handler, or
+// in any interceptor after it, into a codes.Internal error.
+func UnaryRecovery(log logrus.FieldLogger, app *newrelic.Application) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recovered(ctx, log, app, info.FullMethod, p)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamRecovery is the streaming counterpart of UnaryRecovery.
+func StreamRecovery(log logrus.FieldLogger, app *newrelic.Application) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recovered(ss.Context(), log, app, info.FullMethod, p)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+func recovered(ctx context.Context, log logrus.FieldLogger, app *newrelic.Application, method string, p interface{}) error {
+	fields := logrus.Fields{
+		"method": method,
+		"panic":  fmt.Sprint(p),
+		"stack":  string(debug.Stack()),
+	}
+	if id := RequestIDFromContext(ctx); id != "" {
+		fields["request_id"] = id
+	}
+	if pr, ok := peer.FromContext(ctx); ok {
+		fields["peer"] = pr.Addr.String()
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		fields["metadata"] = redact(md)
+	}
+
+	log.WithFields(fields).Error("recovered from panic")
+	app.RecordCustomMetric("Panic", 1)
+	return errPanic
+}
+
+// redact returns a copy of md that is safe to log.
+func redact(md metadata.MD) metadata.MD {
+	md = md.Copy()
+	for key := range md {
+		if key == "authorization" || strings.HasSuffix(key, "-bin") {
+			md[key] = []string{"REDACTED"}
+		}
+	}
+	return md
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryRecovery(t *testing.T) {
+	log, hook := test.NewNullLogger()
+	interceptor := UnaryRecovery(log, nil)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer secret"))
+	info := &grpc.UnaryServerInfo{FullMethod: "/hello.v1.HelloService/SayHello"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("database password is hunter2")
+	}
+
+	_, err := interceptor(ctx, nil, info, handler)
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("UnaryRecovery() got error %v, wanted code %s", err, codes.Internal)
+	}
+	if strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("UnaryRecovery() leaked the panic value to the caller: %v", err)
+	}
+
+	entry := hook.LastEntry()
+	if entry == nil || entry.Level != logrus.ErrorLevel {
+		t.Fatalf("UnaryRecovery() did not log the panic")
+	}
+	if !strings.Contains(entry.Data["stack"].(string), "TestUnaryRecovery") {
+		t.Errorf("UnaryRecovery() logged a stack without the panicking handler")
+	}
+	if md := entry.Data["metadata"].(metadata.MD); md.Get("authorization")[0] != "REDACTED" {
+		t.Errorf("UnaryRecovery() logged the authorization header: %v", md)
+	}
+}
+
+func TestUnaryRecoveryPassesThrough(t *testing.T) {
+	log, hook := test.NewNullLogger()
+	interceptor := UnaryRecovery(log, nil)
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/hello.v1.HelloService/SayHello"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	resp, err := interceptor(context.Background(), nil, info, handler)
+	if err != nil || resp != "ok" {
+		t.Errorf("UnaryRecovery() got (%v, %v), wanted (ok, nil)", resp, err)
+	}
+	if len(hook.AllEntries()) != 0 {
+		t.Errorf("UnaryRecovery() logged without a panic")
+	}
+}
+
+func TestStreamRecovery(t *testing.T) {
+	log, _ := test.NewNullLogger()
+	interceptor := StreamRecovery(log, nil)
+
+	info := &grpc.StreamServerInfo{FullMethod: "/grpc.health.v1.Health/Watch"}
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		panic("boom")
+	}
+
+	err := interceptor(nil, &serverStream{ctx: context.Background()}, info, handler)
+	if status.Code(err) != codes.Internal {
+		t.Errorf("StreamRecovery() got error %v, wanted code %s", err, codes.Internal)
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
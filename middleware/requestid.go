@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDKey is the metadata key carrying the ID that ties together the
+// log lines, traces and downstream calls made for one request.
+const RequestIDKey = "x-request-id"
+
+// maxRequestIDLength bounds the IDs accepted from callers so that they cannot
+// bloat every log line.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+type loggerKey struct{}
+
+// RequestIDFromContext returns the ID of the call being served on ctx, or ""
+// outside of UnaryRequestID and StreamRequestID.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Logger returns the logger for the call being served on ctx, which adds the
+// request ID to every entry, or the standard logger outside of a call.
+func Logger(ctx context.Context) logrus.FieldLogger {
+	if log, ok := ctx.Value(loggerKey{}).(logrus.FieldLogger); ok {
+		return log
+	}
+	return logrus.StandardLogger()
+}
+
+// UnaryRequestID returns an interceptor giving each call the request ID its
+// caller sent, or a new one if it sent none or one that is not usable. The ID
+// is returned in the response header and trailer, added to the fields of the
+// call's Logger and attached to calls the handler makes with its context.
+func UnaryRequestID(log logrus.FieldLogger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, md := withRequestID(ctx, log)
+		// the header is sent with the response, or merged into the
+		// trailer if the call fails before one is sent
+		grpc.SetHeader(ctx, md)
+		grpc.SetTrailer(ctx, md)
+		return handler(ctx, req)
+	}
+}
+
+// StreamRequestID is the streaming counterpart of UnaryRequestID.
+func StreamRequestID(log logrus.FieldLogger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, md := withRequestID(ss.Context(), log)
+		ss.SetHeader(md)
+		ss.SetTrailer(md)
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func withRequestID(ctx context.Context, log logrus.FieldLogger) (context.Context, metadata.MD) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIDKey); len(values) > 0 && validRequestID(values[0]) {
+			id = values[0]
+		}
+	}
+	if id == "" {
+		id = newRequestID()
+	}
+
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	ctx = context.WithValue(ctx, loggerKey{}, log.WithField("request_id", id))
+	ctx = metadata.AppendToOutgoingContext(ctx, RequestIDKey, id)
+	return ctx, metadata.Pairs(RequestIDKey, id)
+}
+
+// validRequestID reports whether id is short and printable enough to log and
+// pass on as it is.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// UnaryRequestIDAttribute returns an interceptor adding the request ID to the
+// call's New Relic transaction. It must come after the interceptor starting
+// the transaction.
+func UnaryRequestIDAttribute() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if id := RequestIDFromContext(ctx); id != "" {
+			newrelic.FromContext(ctx).AddAttribute("request.id", id)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// UnaryClientRequestID returns a client interceptor sending a request ID with
+// every call: the one already in the outgoing metadata, such as the ID of the
+// call being served, or a new one. Every attempt of the call carries the same
+// ID. Errors from the call report it through RequestIDFromError.
+func UnaryClientRequestID() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		var id string
+		if md, ok := metadata.FromOutgoingContext(ctx); ok {
+			if values := md.Get(RequestIDKey); len(values) > 0 {
+				id = values[0]
+			}
+		}
+		if id == "" {
+			id = newRequestID()
+			ctx = metadata.AppendToOutgoingContext(ctx, RequestIDKey, id)
+		}
+
+		if err := invoker(ctx, method, req, reply, cc, opts...); err != nil {
+			return &requestIDError{err: err, id: id}
+		}
+		return nil
+	}
+}
+
+// requestIDError keeps the status of the error it wraps, so that codes and
+// details read from it are unchanged.
+type requestIDError struct {
+	err error
+	id  string
+}
+
+func (e *requestIDError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requestIDError) Unwrap() error {
+	return e.err
+}
+
+func (e *requestIDError) GRPCStatus() *status.Status {
+	return status.Convert(e.err)
+}
+
+// RequestIDFromError returns the request ID sent with the call that failed
+// with err, or "" if err did not come from UnaryClientRequestID.
+func RequestIDFromError(err error) string {
+	var e *requestIDError
+	if errors.As(err, &e) {
+		return e.id
+	}
+	return ""
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	pb "github.com/jamiewhitney/grpc-go-vault/hello/v1"
+	"github.com/jamiewhitney/grpc-go-vault/internal/testutil"
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryRequestID(t *testing.T) {
+	log, _ := test.NewNullLogger()
+	c := testutil.DialHello(t, grpc.UnaryInterceptor(UnaryRequestID(log)))
+
+	tests := []struct {
+		sent string
+		kept bool
+	}{
+		{"abc-123", true},
+		{"", false},
+		{"has space", false},
+		{strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.sent != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, RequestIDKey, tt.sent)
+		}
+		var header, trailer metadata.MD
+		if _, err := c.SayHello(ctx, &pb.HelloRequest{Name: "world"}, grpc.Header(&header), grpc.Trailer(&trailer)); err != nil {
+			t.Fatalf("SayHello() got unexpected error: %v", err)
+		}
+
+		got := header.Get(RequestIDKey)
+		if len(got) != 1 || (got[0] == tt.sent) != tt.kept || got[0] == "" {
+			t.Errorf("SayHello() with request ID %q got header %v, wanted it kept: %t", tt.sent, got, tt.kept)
+		}
+		if tr := trailer.Get(RequestIDKey); len(tr) != 1 || len(got) == 1 && tr[0] != got[0] {
+			t.Errorf("SayHello() got trailer %v, wanted the header's %v", tr, got)
+		}
+	}
+}
+
+func TestUnaryRequestIDOnRejection(t *testing.T) {
+	log, _ := test.NewNullLogger()
+	reject := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return nil, status.Error(codes.ResourceExhausted, "too many requests")
+	}
+	c := testutil.DialHello(t, grpc.ChainUnaryInterceptor(UnaryRequestID(log), reject))
+
+	var trailer metadata.MD
+	ctx := metadata.AppendToOutgoingContext(context.Background(), RequestIDKey, "abc")
+	if _, err := c.SayHello(ctx, &pb.HelloRequest{}, grpc.Trailer(&trailer)); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("SayHello() got error %v, wanted code %s", err, codes.ResourceExhausted)
+	}
+	if got := trailer.Get(RequestIDKey); len(got) != 1 || got[0] != "abc" {
+		t.Errorf("SayHello() got trailer %v, wanted request ID abc", got)
+	}
+}
+
+func TestUnaryRequestIDPropagates(t *testing.T) {
+	log, hook := test.NewNullLogger()
+	interceptor := UnaryRequestID(log)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(RequestIDKey, "abc"))
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		if got := RequestIDFromContext(ctx); got != "abc" {
+			t.Errorf("RequestIDFromContext() got %q, wanted %q", got, "abc")
+		}
+		md, _ := metadata.FromOutgoingContext(ctx)
+		if got := md.Get(RequestIDKey); len(got) != 1 || got[0] != "abc" {
+			t.Errorf("outgoing metadata got request ID %v, wanted abc", got)
+		}
+		Logger(ctx).Info("handled")
+		return nil, nil
+	}
+	// grpc.SetHeader fails outside of a real call, which the interceptor
+	// ignores
+	interceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+
+	if entry := hook.LastEntry(); entry == nil || entry.Data["request_id"] != "abc" {
+		t.Errorf("Logger() did not add the request ID to %v", entry)
+	}
+}
+
+func TestUnaryClientRequestID(t *testing.T) {
+	interceptor := UnaryClientRequestID()
+	sent := func(ctx context.Context) (string, error) {
+		var id string
+		invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			md, _ := metadata.FromOutgoingContext(ctx)
+			if values := md.Get(RequestIDKey); len(values) == 1 {
+				id = values[0]
+			}
+			return status.Error(codes.Unavailable, "down")
+		}
+		err := interceptor(ctx, "/hello.v1.HelloService/SayHello", nil, nil, nil, invoker)
+		return id, err
+	}
+
+	id, err := sent(context.Background())
+	if len(id) != 32 {
+		t.Errorf("interceptor sent request ID %q, wanted a new one", id)
+	}
+	if status.Code(err) != codes.Unavailable || RequestIDFromError(err) != id {
+		t.Errorf("interceptor got error %v with request ID %q, wanted code %s and %q", err, RequestIDFromError(err), codes.Unavailable, id)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), RequestIDKey, "abc")
+	if id, _ := sent(ctx); id != "abc" {
+		t.Errorf("interceptor sent request ID %q, wanted the caller's abc", id)
+	}
+}
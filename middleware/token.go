@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+var errInvalidBearerToken = Status(codes.Unauthenticated, "invalid bearer token", ReasonInvalidToken, nil).Err()
+
+// UnaryBearerToken returns an interceptor admitting only calls presenting
+// token as their bearer token.
+func UnaryBearerToken(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !hasBearerToken(ctx, token) {
+			return nil, errInvalidBearerToken
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamBearerToken is the streaming counterpart of UnaryBearerToken.
+func StreamBearerToken(token string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !hasBearerToken(ss.Context(), token) {
+			return errInvalidBearerToken
+		}
+		return handler(srv, ss)
+	}
+}
+
+func hasBearerToken(ctx context.Context, token string) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	authorization := md.Get("authorization")
+	if len(authorization) < 1 || !strings.HasPrefix(authorization[0], "Bearer ") {
+		return false
+	}
+	given := strings.TrimPrefix(authorization[0], "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
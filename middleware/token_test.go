@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/jamiewhitney/grpc-go-vault/hello/v1"
+	"github.com/jamiewhitney/grpc-go-vault/internal/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryBearerToken(t *testing.T) {
+	c := testutil.DialHello(t, grpc.UnaryInterceptor(UnaryBearerToken("s3cret")))
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          codes.Code
+	}{
+		{"valid token", "Bearer s3cret", codes.OK},
+		{"wrong token", "Bearer guess", codes.Unauthenticated},
+		{"missing scheme", "s3cret", codes.Unauthenticated},
+		{"missing header", "", codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.authorization != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", tt.authorization)
+		}
+		_, err := c.SayHello(ctx, &pb.HelloRequest{Name: "world"})
+		if got := status.Code(err); got != tt.want {
+			t.Errorf("%s: SayHello() got code %s, wanted %s", tt.name, got, tt.want)
+		}
+	}
+}
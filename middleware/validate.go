@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// validator is implemented by messages with generated validation rules.
+type validator interface {
+	ValidateAll() error
+}
+
+// fieldError is implemented by each generated validation error.
+type fieldError interface {
+	Field() string
+	Reason() string
+	Cause() error
+}
+
+// multiError is implemented by the generated error aggregating every
+// violation in a message.
+type multiError interface {
+	AllErrors() []error
+}
+
+// UnaryValidator returns an interceptor rejecting requests that break the
+// rules declared in their proto definition with codes.InvalidArgument and a
+// BadRequest detail listing every violated field.
+func UnaryValidator() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := validate(req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamValidator is the streaming counterpart of UnaryValidator, checking
+// each message received from the client.
+func StreamValidator() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &validatingStream{ServerStream: ss})
+	}
+}
+
+type validatingStream struct {
+	grpc.ServerStream
+}
+
+func (s *validatingStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return validate(m)
+}
+
+func validate(msg interface{}) error {
+	v, ok := msg.(validator)
+	if !ok {
+		return nil
+	}
+	err := v.ValidateAll()
+	if err == nil {
+		return nil
+	}
+
+	var desc protoreflect.MessageDescriptor
+	if m, ok := msg.(proto.Message); ok {
+		desc = m.ProtoReflect().Descriptor()
+	}
+	return Status(codes.InvalidArgument, "invalid request", ReasonInvalidRequest, nil,
+		&errdetails.BadRequest{FieldViolations: violations(desc, "", err)},
+	).Err()
+}
+
+// violations flattens a validation error into one violation per field,
+// naming fields of embedded messages by their dotted path of proto field
+// names, as described by desc.
+func violations(desc protoreflect.MessageDescriptor, prefix string, err error) []*errdetails.BadRequest_FieldViolation {
+	var multi multiError
+	if errors.As(err, &multi) {
+		var out []*errdetails.BadRequest_FieldViolation
+		for _, err := range multi.AllErrors() {
+			out = append(out, violations(desc, prefix, err)...)
+		}
+		return out
+	}
+
+	fe, ok := err.(fieldError)
+	if !ok {
+		return []*errdetails.BadRequest_FieldViolation{{Field: prefix, Description: err.Error()}}
+	}
+	name, fd := protoField(desc, fe.Field())
+	field := name
+	if prefix != "" {
+		field = prefix + "." + name
+	}
+	if cause := fe.Cause(); cause != nil {
+		var nested protoreflect.MessageDescriptor
+		if fd != nil {
+			nested = fd.Message()
+			if fd.IsMap() {
+				nested = fd.MapValue().Message()
+			}
+		}
+		if _, ok := cause.(fieldError); ok {
+			return violations(nested, field, cause)
+		}
+		if errors.As(cause, &multi) {
+			return violations(nested, field, cause)
+		}
+	}
+	return []*errdetails.BadRequest_FieldViolation{{Field: field, Description: fe.Reason()}}
+}
+
+// protoField maps the Go field name the generated validators report, with
+// any "[index]" or "[key]" suffix, to the proto field name in desc. Names
+// not found in desc are returned unchanged.
+func protoField(desc protoreflect.MessageDescriptor, goName string) (string, protoreflect.FieldDescriptor) {
+	if desc == nil {
+		return goName, nil
+	}
+	base, suffix := goName, ""
+	if i := strings.IndexByte(goName, '['); i >= 0 {
+		base, suffix = goName[:i], goName[i:]
+	}
+
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		// Go names are the proto names in camel case
+		if strings.EqualFold(strings.ReplaceAll(string(fd.Name()), "_", ""), base) {
+			return string(fd.Name()) + suffix, fd
+		}
+	}
+	return goName, nil
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	pb "github.com/jamiewhitney/grpc-go-vault/hello/v1"
+	"github.com/jamiewhitney/grpc-go-vault/internal/testutil"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryValidator(t *testing.T) {
+	c := testutil.DialHello(t, grpc.UnaryInterceptor(UnaryValidator()))
+
+	tests := []struct {
+		name string
+		in   string
+		want codes.Code
+	}{
+		{"valid", "world", codes.OK},
+		{"empty", "", codes.InvalidArgument},
+		{"too long", strings.Repeat("a", 65), codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		_, err := c.SayHello(context.Background(), &pb.HelloRequest{Name: tt.in})
+		if got := status.Code(err); got != tt.want {
+			t.Errorf("%s: SayHello() got code %s, wanted %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateFieldViolations(t *testing.T) {
+	tests := []struct {
+		req  interface{}
+		want string
+	}{
+		{&pb.CreateUserRequest{Id: "not valid!"}, "id,name"},
+		{&pb.ListUsersRequest{PageSize: -1}, "page_size"},
+	}
+	for _, tt := range tests {
+		st := status.Convert(validate(tt.req))
+		if st.Code() != codes.InvalidArgument {
+			t.Fatalf("validate(%T) got code %s, wanted %s", tt.req, st.Code(), codes.InvalidArgument)
+		}
+
+		var fields []string
+		for _, detail := range st.Details() {
+			if br, ok := detail.(*errdetails.BadRequest); ok {
+				for _, v := range br.GetFieldViolations() {
+					fields = append(fields, v.GetField())
+				}
+			}
+		}
+		if got := strings.Join(fields, ","); got != tt.want {
+			t.Errorf("validate(%T) got violations for %q, wanted %q", tt.req, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Package output prints the client's results for people, as indented
+// "name: value" text, or for scripts, as one JSON document per line.
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Printer writes results in one format.
+type Printer struct {
+	w    io.Writer
+	json bool
+}
+
+// New returns a Printer writing to w in format, which is "text" or "json".
+func New(w io.Writer, format string) (*Printer, error) {
+	switch format {
+	case "text":
+		return &Printer{w: w}, nil
+	case "json":
+		return &Printer{w: w, json: true}, nil
+	}
+	return nil, fmt.Errorf("output format %q is not one of text or json", format)
+}
+
+// Print writes v, a proto message or a struct whose fields are named by
+// their json tags. Text output leaves out unset fields.
+func (p *Printer) Print(v interface{}) error {
+	if p.json {
+		return p.printJSON(v)
+	}
+
+	var b strings.Builder
+	if m, ok := v.(proto.Message); ok {
+		writeMessage(&b, m.ProtoReflect(), "")
+	} else {
+		writeStruct(&b, reflect.Indirect(reflect.ValueOf(v)))
+	}
+	_, err := io.WriteString(p.w, b.String())
+	return err
+}
+
+func (p *Printer) printJSON(v interface{}) error {
+	var (
+		data []byte
+		err  error
+	)
+	if m, ok := v.(proto.Message); ok {
+		data, err = protojson.Marshal(m)
+	} else {
+		data, err = json.Marshal(v)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(p.w, "%s\n", data)
+	return err
+}
+
+func writeMessage(b *strings.Builder, m protoreflect.Message, indent string) {
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if !m.Has(fd) {
+			continue
+		}
+		name := string(fd.Name())
+		v := m.Get(fd)
+
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			fmt.Fprintf(b, "%s%s:\n", indent, name)
+			list := v.List()
+			for j := 0; j < list.Len(); j++ {
+				writeItem(b, list.Get(j).Message(), indent)
+			}
+		case fd.IsList():
+			list := v.List()
+			values := make([]string, list.Len())
+			for j := range values {
+				values[j] = list.Get(j).String()
+			}
+			fmt.Fprintf(b, "%s%s: %s\n", indent, name, strings.Join(values, ", "))
+		case fd.Message() != nil && fd.Message().FullName() == "google.protobuf.Timestamp":
+			ts := v.Message().Interface().(*timestamppb.Timestamp)
+			fmt.Fprintf(b, "%s%s: %s\n", indent, name, ts.AsTime().Format(time.RFC3339))
+		case fd.Message() != nil && !fd.IsMap():
+			fmt.Fprintf(b, "%s%s:\n", indent, name)
+			writeMessage(b, v.Message(), indent+"  ")
+		default:
+			fmt.Fprintf(b, "%s%s: %v\n", indent, name, v.Interface())
+		}
+	}
+}
+
+func writeStruct(b *strings.Builder, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		f := v.Field(i)
+		if name == "" || name == "-" || f.IsZero() {
+			continue
+		}
+
+		switch value := f.Interface().(type) {
+		case time.Time:
+			fmt.Fprintf(b, "%s: %s\n", name, value.Format(time.RFC3339))
+		case []string:
+			fmt.Fprintf(b, "%s: %s\n", name, strings.Join(value, ", "))
+		default:
+			if f.Kind() == reflect.Map {
+				writeMap(b, name, f)
+				continue
+			}
+			fmt.Fprintf(b, "%s: %v\n", name, value)
+		}
+	}
+}
+
+// writeMap writes a map field with one indented line per entry, ordered by
+// key.
+func writeMap(b *strings.Builder, name string, m reflect.Value) {
+	entries := make([]string, 0, m.Len())
+	iter := m.MapRange()
+	for iter.Next() {
+		entries = append(entries, fmt.Sprintf("  %v: %v\n", iter.Key(), iter.Value()))
+	}
+	sort.Strings(entries)
+	fmt.Fprintf(b, "%s:\n%s", name, strings.Join(entries, ""))
+}
+
+// writeItem writes one message of a list as a "- " bullet, with its fields
+// aligned under the first.
+func writeItem(b *strings.Builder, m protoreflect.Message, indent string) {
+	var item strings.Builder
+	writeMessage(&item, m, indent+"    ")
+	lines := strings.TrimPrefix(item.String(), indent+"    ")
+	fmt.Fprintf(b, "%s  - %s", indent, lines)
+}
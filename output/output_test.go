@@ -0,0 +1,93 @@
+package output
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/jamiewhitney/grpc-go-vault/hello/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type certificate struct {
+	Subject  string         `json:"subject"`
+	DNSNames []string       `json:"dns_names"`
+	Serial   string         `json:"serial,omitempty"`
+	NotAfter time.Time      `json:"not_after"`
+	Usages   map[string]int `json:"usages,omitempty"`
+}
+
+func TestPrinter(t *testing.T) {
+	created := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		format string
+		v      interface{}
+		want   string
+	}{
+		{
+			name:   "text message",
+			format: "text",
+			v:      &pb.HelloResponse{Greeting: "Hello Jamie", ServerTime: timestamppb.New(created)},
+			want:   "greeting: Hello Jamie\nserver_time: 2026-10-19T12:00:00Z\n",
+		},
+		{
+			name:   "text list",
+			format: "text",
+			v: &pb.ListUsersResponse{
+				Users: []*pb.User{
+					{Id: "alice", Name: "Alice"},
+					{Id: "bob", Name: "Bob", CreateTime: timestamppb.New(created)},
+				},
+				NextPageToken: "Ym9i",
+			},
+			want: "users:\n  - id: alice\n    name: Alice\n  - id: bob\n    name: Bob\n    create_time: 2026-10-19T12:00:00Z\nnext_page_token: Ym9i\n",
+		},
+		{
+			name:   "text struct",
+			format: "text",
+			v:      certificate{Subject: "CN=grpc.example.com", DNSNames: []string{"grpc.example.com", "localhost"}, NotAfter: created, Usages: map[string]int{"server": 2, "client": 1}},
+			want:   "subject: CN=grpc.example.com\ndns_names: grpc.example.com, localhost\nnot_after: 2026-10-19T12:00:00Z\nusages:\n  client: 1\n  server: 2\n",
+		},
+		{
+			name:   "json struct",
+			format: "json",
+			v:      certificate{Subject: "CN=grpc.example.com", NotAfter: created},
+			want:   `{"subject":"CN=grpc.example.com","dns_names":null,"not_after":"2026-10-19T12:00:00Z"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var b strings.Builder
+		p, err := New(&b, tt.format)
+		if err != nil {
+			t.Fatalf("%s: New() got unexpected error: %v", tt.name, err)
+		}
+		if err := p.Print(tt.v); err != nil {
+			t.Fatalf("%s: Print() got unexpected error: %v", tt.name, err)
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s: Print() got %q, wanted %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := New(&strings.Builder{}, "yaml"); err == nil {
+		t.Errorf("New() with format yaml got no error")
+	}
+}
+
+func TestPrinterJSONMessage(t *testing.T) {
+	var b strings.Builder
+	p, _ := New(&b, "json")
+	if err := p.Print(&pb.User{Id: "alice", Name: "Alice"}); err != nil {
+		t.Fatalf("Print() got unexpected error: %v", err)
+	}
+	// protojson deliberately varies its whitespace, so compare without it.
+	if got := strings.Join(strings.Fields(b.String()), ""); got != `{"id":"alice","name":"Alice"}` {
+		t.Errorf("Print() got %q, wanted %q", got, `{"id":"alice","name":"Alice"}`)
+	}
+	if !strings.HasSuffix(b.String(), "}\n") {
+		t.Errorf("Print() got %q, wanted one line", b.String())
+	}
+}
@@ -0,0 +1,149 @@
+// Package pki obtains TLS material and secrets from Vault, retrying requests
+// that fail for transient reasons. Every request is bounded by the context
+// it is given, so handlers pass their own context to keep Vault calls within
+// the deadline of the call they serve.
+package pki
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/jamiewhitney/grpc-go-vault/config"
+)
+
+const maxAttempts = 5
+
+var (
+	initialBackoff = 500 * time.Millisecond
+	maxBackoff     = 8 * time.Second
+)
+
+// Certificate is a certificate issued by Vault's PKI secrets engine.
+type Certificate struct {
+	Secret *vault.Secret
+	Bundle *certutil.ParsedCertBundle
+}
+
+// TLSConfig builds a TLS configuration presenting the certificate and
+// trusting its issuing CA.
+func (c *Certificate) TLSConfig(usage certutil.TLSUsage) (*tls.Config, error) {
+	tlsConfig, err := c.Bundle.GetTLSConfig(usage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build TLS config: %w", err)
+	}
+	return tlsConfig, nil
+}
+
+// Login creates a Vault client and checks that its token is usable.
+func Login(ctx context.Context, cfg config.Vault) (*vault.Client, error) {
+	client, err := vault.NewClient(&vault.Config{
+		Address: cfg.Address,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault client: %w", err)
+	}
+	client.SetToken(cfg.Token)
+
+	err = retry(ctx, func() error {
+		_, err := client.Auth().Token().LookupSelfWithContext(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up vault token: %w", err)
+	}
+	return client, nil
+}
+
+// Issue requests a certificate for the configured common name and
+// alternative names.
+func Issue(ctx context.Context, client *vault.Client, cfg config.Vault) (*Certificate, error) {
+	var secret *vault.Secret
+	err := retry(ctx, func() error {
+		var err error
+		secret, err = client.Logical().WriteWithContext(ctx, cfg.IssuePath, map[string]interface{}{
+			"common_name": cfg.CommonName,
+			"alt_names":   cfg.AltNames,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue certificate from %s: %w", cfg.IssuePath, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("no certificate returned from %s", cfg.IssuePath)
+	}
+
+	bundle, err := certutil.ParsePKIMap(secret.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate from %s: %w", cfg.IssuePath, err)
+	}
+	return &Certificate{Secret: secret, Bundle: bundle}, nil
+}
+
+// ReadKV reads the data of a KV version 2 secret.
+func ReadKV(ctx context.Context, client *vault.Client, path string) (map[string]interface{}, error) {
+	var secret *vault.Secret
+	err := retry(ctx, func() error {
+		var err error
+		secret, err = client.Logical().ReadWithContext(ctx, path)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret %s: %w", path, err)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("secret %s not found", path)
+	}
+
+	data, ok := secret.Data["data"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("secret %s is not a KV version 2 secret", path)
+	}
+	return data, nil
+}
+
+// retry calls fn until it succeeds, fails with a permanent error, runs out of
+// attempts or ctx is done, backing off exponentially between attempts. An
+// attempt that could only start after ctx's deadline is not waited for, so
+// callers serving a request fail within the request's deadline.
+func retry(ctx context.Context, fn func() error) error {
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !transient(err) || attempt == maxAttempts {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// transient reports whether err is worth retrying: network failures, rate
+// limiting and server-side errors, including a sealed or standby Vault.
+func transient(err error) bool {
+	var respErr *vault.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode == http.StatusTooManyRequests || respErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
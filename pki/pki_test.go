@@ -0,0 +1,86 @@
+package pki
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jamiewhitney/grpc-go-vault/config"
+)
+
+func init() {
+	initialBackoff = time.Millisecond
+}
+
+func TestLoginRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		wantErr  bool
+		wantHits int32
+	}{
+		{
+			name:     "transient failures",
+			statuses: []int{http.StatusServiceUnavailable, http.StatusInternalServerError, http.StatusOK},
+			wantHits: 3,
+		},
+		{
+			name:     "permanent failure",
+			statuses: []int{http.StatusForbidden},
+			wantErr:  true,
+			wantHits: 1,
+		},
+		{
+			name:     "too many failures",
+			statuses: []int{503, 503, 503, 503, 503, 503},
+			wantErr:  true,
+			wantHits: maxAttempts,
+		},
+	}
+
+	for _, tt := range tests {
+		var hits int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			status := tt.statuses[atomic.AddInt32(&hits, 1)-1]
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			if status == http.StatusOK {
+				w.Write([]byte(`{"data":{"id":"root"}}`))
+				return
+			}
+			w.Write([]byte(`{"errors":["unavailable"]}`))
+		}))
+
+		_, err := Login(context.Background(), config.Vault{Address: srv.URL, Token: "root"})
+		srv.Close()
+
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Login() got error %v, wanted error: %v", tt.name, err, tt.wantErr)
+		}
+		if hits != tt.wantHits {
+			t.Errorf("%s: Login() made %d requests, wanted %d", tt.name, hits, tt.wantHits)
+		}
+	}
+}
+
+func TestRetryStopsBeforeDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), initialBackoff/2)
+	defer cancel()
+
+	var calls int
+	err := retry(ctx, func() error {
+		calls++
+		return &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	})
+	if err == nil {
+		t.Errorf("retry() got no error")
+	}
+	if calls != 1 {
+		t.Errorf("retry() made %d calls, wanted 1", calls)
+	}
+}
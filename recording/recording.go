@@ -0,0 +1,187 @@
+// Package recording records the unary calls a server receives as JSON Lines,
+// one Entry per call, and reads them back for the client to replay.
+package recording
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jamiewhitney/grpc-go-vault/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Entry is a recorded call.
+type Entry struct {
+	// Time is when the call arrived.
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	// Metadata holds the allowed request metadata the call carried.
+	Metadata map[string][]string `json:"metadata,omitempty"`
+	// Request is the request message in its protobuf JSON encoding.
+	Request json.RawMessage `json:"request"`
+	// Duration is how long the server took to handle the call, in
+	// milliseconds.
+	Duration float64 `json:"duration_ms"`
+	// Code is the status code the call ended with.
+	Code string `json:"code"`
+}
+
+// Messages returns the request recorded in e and an empty response, of the
+// types the method's descriptor names. The method's generated code must be
+// linked into the binary.
+func (e *Entry) Messages() (req, resp proto.Message, err error) {
+	name := strings.TrimPrefix(e.Method, "/")
+	i := strings.LastIndex(name, "/")
+	if i < 0 {
+		return nil, nil, fmt.Errorf("method %q is not /service/method", e.Method)
+	}
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name[:i]))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unknown service in %s: %w", e.Method, err)
+	}
+	service, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s is not a service", name[:i])
+	}
+	method := service.Methods().ByName(protoreflect.Name(name[i+1:]))
+	if method == nil {
+		return nil, nil, fmt.Errorf("unknown method %s", e.Method)
+	}
+
+	reqType, err := protoregistry.GlobalTypes.FindMessageByName(method.Input().FullName())
+	if err != nil {
+		return nil, nil, err
+	}
+	respType, err := protoregistry.GlobalTypes.FindMessageByName(method.Output().FullName())
+	if err != nil {
+		return nil, nil, err
+	}
+	req = reqType.New().Interface()
+	if err := protojson.Unmarshal(e.Request, req); err != nil {
+		return nil, nil, fmt.Errorf("invalid request for %s: %w", e.Method, err)
+	}
+	return req, respType.New().Interface(), nil
+}
+
+// Recorder appends an Entry for every call to a writer.
+type Recorder struct {
+	keys []string
+	logf func(format string, args ...interface{})
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewRecorder creates a Recorder writing to w and keeping the metadata keys
+// listed in cfg. With a nil w calls are not recorded. Failures to write are
+// reported through logf without failing the call.
+func NewRecorder(w io.Writer, cfg config.Record, logf func(format string, args ...interface{})) *Recorder {
+	r := &Recorder{logf: logf}
+	if w != nil {
+		r.enc = json.NewEncoder(w)
+	}
+	for _, key := range cfg.Metadata {
+		// authorization is rejected by validation, but never record
+		// credentials whatever the configuration.
+		if key = strings.ToLower(key); key != "authorization" {
+			r.keys = append(r.keys, key)
+		}
+	}
+	return r
+}
+
+// Unary returns an interceptor recording each call once it has been handled.
+func (r *Recorder) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if r.enc == nil {
+			return handler(ctx, req)
+		}
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		if recordErr := r.record(ctx, info.FullMethod, req, start, err); recordErr != nil {
+			r.logf("failed to record %s: %s", info.FullMethod, recordErr)
+		}
+		return resp, err
+	}
+}
+
+func (r *Recorder) record(ctx context.Context, method string, req interface{}, start time.Time, callErr error) error {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return fmt.Errorf("request %T is not a proto message", req)
+	}
+	request, err := protojson.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	entry := Entry{
+		Time:     start.UTC(),
+		Method:   method,
+		Request:  request,
+		Duration: float64(time.Since(start)) / float64(time.Millisecond),
+		Code:     status.Code(callErr).String(),
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, key := range r.keys {
+			if values := md.Get(key); len(values) > 0 {
+				if entry.Metadata == nil {
+					entry.Metadata = make(map[string][]string)
+				}
+				entry.Metadata[key] = values
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.enc.Encode(entry)
+}
+
+// Reader reads entries from a recording one at a time, so that recordings of
+// any length can be replayed.
+type Reader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewReader returns a Reader reading the JSON Lines in r.
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	return &Reader{scanner: scanner}
+}
+
+// Next returns the next entry, or io.EOF once there are none left. Blank
+// lines are skipped.
+func (r *Reader) Next() (*Entry, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := r.scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		entry := &Entry{}
+		if err := json.Unmarshal(line, entry); err != nil {
+			return nil, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		return entry, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
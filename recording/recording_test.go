@@ -0,0 +1,95 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/jamiewhitney/grpc-go-vault/config"
+	pb "github.com/jamiewhitney/grpc-go-vault/hello/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	recorder := NewRecorder(&buf, config.Record{Metadata: []string{"X-Request-Id", "authorization"}}, t.Logf)
+	interceptor := recorder.Unary()
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"authorization", "Bearer secret",
+		"x-request-id", "abc",
+		"user-agent", "test",
+	))
+	info := &grpc.UnaryServerInfo{FullMethod: "/hello.v1.HelloService/SayHello"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "no")
+	}
+	if _, err := interceptor(ctx, &pb.HelloRequest{Name: "Jamie"}, info, handler); status.Code(err) != codes.NotFound {
+		t.Errorf("interceptor got error %v, wanted the handler's", err)
+	}
+
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("recording contains the bearer token: %s", buf.String())
+	}
+
+	r := NewReader(strings.NewReader("\n" + buf.String()))
+	entry, err := r.Next()
+	if err != nil {
+		t.Fatalf("Next() got unexpected error: %v", err)
+	}
+	if entry.Method != info.FullMethod || entry.Code != "NotFound" || entry.Time.IsZero() {
+		t.Errorf("Next() got %+v", entry)
+	}
+	if len(entry.Metadata) != 1 || entry.Metadata["x-request-id"][0] != "abc" {
+		t.Errorf("Next() got metadata %v, wanted only x-request-id", entry.Metadata)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("Next() at the end got %v, wanted io.EOF", err)
+	}
+
+	req, resp, err := entry.Messages()
+	if err != nil {
+		t.Fatalf("Messages() got unexpected error: %v", err)
+	}
+	if got := req.(*pb.HelloRequest).GetName(); got != "Jamie" {
+		t.Errorf("Messages() got request name %q, wanted %q", got, "Jamie")
+	}
+	if _, ok := resp.(*pb.HelloResponse); !ok {
+		t.Errorf("Messages() got response %T, wanted *hellov1.HelloResponse", resp)
+	}
+}
+
+func TestRecorderDisabled(t *testing.T) {
+	interceptor := NewRecorder(nil, config.Record{}, t.Logf).Unary()
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	resp, err := interceptor(context.Background(), &pb.HelloRequest{}, &grpc.UnaryServerInfo{}, handler)
+	if resp != "ok" || err != nil {
+		t.Errorf("interceptor got %v, %v, wanted the handler's response", resp, err)
+	}
+}
+
+func TestEntryMessagesUnknownMethod(t *testing.T) {
+	for _, method := range []string{"SayHello", "/hello.v1.Missing/SayHello", "/hello.v1.HelloService/Missing"} {
+		e := &Entry{Method: method, Request: []byte(`{}`)}
+		if _, _, err := e.Messages(); err == nil {
+			t.Errorf("Messages() for %s got no error", method)
+		}
+	}
+}
+
+func TestReaderInvalidLine(t *testing.T) {
+	r := NewReader(strings.NewReader(`{"method":"/a/b"}` + "\nnot json\n"))
+	if _, err := r.Next(); err != nil {
+		t.Fatalf("Next() got unexpected error: %v", err)
+	}
+	if _, err := r.Next(); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Next() got error %v, wanted one naming line 2", err)
+	}
+}
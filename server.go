@@ -4,26 +4,63 @@ import (
 	"context"
 	"crypto/rsa"
 	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
-	vault "github.com/hashicorp/vault/api"
+	"github.com/MicahParks/keyfunc"
 	"github.com/hashicorp/vault/sdk/helper/certutil"
 	"github.com/jamiewhitney/auth-jwt-grpc"
+	"github.com/jamiewhitney/grpc-go-vault/admin"
+	"github.com/jamiewhitney/grpc-go-vault/config"
+	"github.com/jamiewhitney/grpc-go-vault/gateway"
 	pb "github.com/jamiewhitney/grpc-go-vault/hello"
+	hellov1 "github.com/jamiewhitney/grpc-go-vault/hello/v1"
+	"github.com/jamiewhitney/grpc-go-vault/listener"
+	"github.com/jamiewhitney/grpc-go-vault/mesh"
+	"github.com/jamiewhitney/grpc-go-vault/middleware"
+	"github.com/jamiewhitney/grpc-go-vault/pki"
+	"github.com/jamiewhitney/grpc-go-vault/recording"
+	"github.com/jamiewhitney/grpc-go-vault/shutdown"
+	"github.com/jamiewhitney/grpc-go-vault/startup"
+	"github.com/jamiewhitney/grpc-go-vault/transport"
+	"github.com/jamiewhitney/grpc-go-vault/users"
+	"github.com/jamiewhitney/grpc-go-vault/web"
 	"github.com/newrelic/go-agent/v3/integrations/nrgrpc"
 	"github.com/newrelic/go-agent/v3/newrelic"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"math/big"
 	"net"
+	"net/http"
+	"strings"
+	"syscall"
 
 	"os"
 	"time"
 )
 
 type server struct {
+	hellov1.UnimplementedHelloServiceServer
+}
+
+// legacyServer serves the deprecated unversioned HelloService on top of
+// server, for clients that predate hello.v1.
+type legacyServer struct {
 	pb.UnimplementedHelloServiceServer
+	v1 *server
 }
 
+// livenessService is reported as SERVING for as long as the process is up,
+// independently of readiness.
+const livenessService = "liveness"
+
 var (
 	Key *rsa.PublicKey
 	app *newrelic.Application
@@ -33,10 +70,46 @@ func main() {
 	log := logrus.New()
 	log.Formatter = &logrus.JSONFormatter{}
 
+	cfg, err := config.Load("server", os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err == nil {
+		err = cfg.ValidateServer()
+	}
+	if err != nil {
+		startup.Exit(log.Errorf, startup.Config.Wrap(err))
+	}
+
+	ctx, stop := shutdown.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, log, cfg); err != nil {
+		startup.Exit(log.Errorf, err)
+	}
+}
+
+// run starts the server and blocks until ctx is cancelled. Failures before
+// the server starts serving are reported as startup.Error.
+func run(ctx context.Context, log *logrus.Logger, cfg *config.Config) error {
+	// health
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthServer.SetServingStatus(livenessService, healthpb.HealthCheckResponse_SERVING)
+
+	if cfg.HealthAddr != "" {
+		probeServer, err := serveHealth(log, cfg.HealthAddr, healthServer)
+		if err != nil {
+			return startup.Listen.Wrap(err)
+		}
+		defer probeServer.Stop()
+	}
+
 	//tracing
-	app, err := newrelic.NewApplication(
-		newrelic.ConfigAppName("gRPC Server"),
-		newrelic.ConfigLicense(MustMapEnv("NEWRELIC_API_KEY")),
+	var err error
+	app, err = newrelic.NewApplication(
+		newrelic.ConfigAppName(cfg.NewRelic.AppName),
+		newrelic.ConfigLicense(cfg.NewRelic.License),
 		func(config *newrelic.Config) {
 			config.Labels = map[string]string{
 				"environment": "production",
@@ -45,8 +118,10 @@ func main() {
 		},
 	)
 	if err != nil {
-		log.Error(err)
+		return startup.Telemetry.Wrap(err)
 	}
+	defer app.Shutdown(10 * time.Second)
+
 	log.Infof("waiting for connection %s,", time.Now())
 	if err := app.WaitForConnection(30 * time.Second); err != nil {
 		log.Error(err)
@@ -54,66 +129,300 @@ func main() {
 	log.Infof("connected %s,", time.Now())
 
 	//vault
-
-	vaultClient, err := vault.NewClient(&vault.Config{
-		Address: os.Getenv("VAULT_ADDR"),
-	})
+	vaultClient, err := pki.Login(ctx, cfg.Vault)
 	if err != nil {
-		fmt.Printf("failed to create vault client: %v", err)
+		return startup.VaultLogin.Wrap(err)
 	}
 
-	vaultClient.SetToken("root")
-
-	secret, err := vaultClient.Logical().Write("grpc/issue/hello-service", map[string]interface{}{
-		"common_name": "grpc.example.com",
-		"alt_names":   "localhost",
-	})
+	cert, err := pki.Issue(ctx, vaultClient, cfg.Vault)
 	if err != nil {
-		fmt.Printf("failed to create certificate: %v", err)
+		return startup.IssueCert.Wrap(err)
+	}
+	// Certificates issued without a lease simply lapse at the end of their TTL.
+	if leaseID := cert.Secret.LeaseID; leaseID != "" {
+		defer func() {
+			if err := vaultClient.Sys().Revoke(leaseID); err != nil {
+				log.Errorf("failed to revoke certificate lease: %s", err)
+			}
+		}()
 	}
 
 	// tls credentials
-
-	parsedCertBundle, err := certutil.ParsePKIMap(secret.Data)
+	tlsConfig, err := cert.TLSConfig(certutil.TLSServer)
 	if err != nil {
-		log.Errorf("Error parsing secret: %s", err)
+		return startup.BuildTLS.Wrap(err)
 	}
 
-	tlsConfig, err := parsedCertBundle.GetTLSConfig(certutil.TLSServer)
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	tlsCredentials := credentials.NewTLS(tlsConfig)
+
+	// auth
+	jwks, err := keyfunc.Get(cfg.Auth.JWKSURL, keyfunc.Options{})
 	if err != nil {
-		log.Errorf("Could not get TLS config: %v", err)
+		return startup.FetchJWKS.Wrap(err)
 	}
 
-	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
-	tlsCredentials := credentials.NewTLS(tlsConfig)
+	authorizer := &auth.Authorizer{
+		Audience: cfg.Auth.Audience,
+		Scope:    cfg.Auth.Scope,
+		Issuer:   cfg.Auth.Issuer,
+		Subject:  cfg.Auth.Subject,
+		Jwks:     jwks,
+	}
 
-	authorizer := auth.NewAuthorizer(MustMapEnv("AUTH0_SCOPE"), MustMapEnv("AUTH0_AUDIENCE"), MustMapEnv("AUTH0_ISSUER"), MustMapEnv("AUTH0_SUBJECT"), MustMapEnv("JWKS_URL"))
 	// grpc server
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", "3000"))
+	listeners, err := listener.Open(cfg.ListenAddr, cfg.UnixSocket)
 	if err != nil {
-		log.Printf("failed to listen: %v", err)
+		return startup.Listen.Wrap(err)
+	}
+
+	// the gateway dials in with the server's own certificate
+	gatewaySerial := cert.Bundle.Certificate.SerialNumber
+	rateLimiter := middleware.NewRateLimiter(cfg.RateLimit, []*big.Int{gatewaySerial}, app)
+	concurrencyLimiter := middleware.NewConcurrencyLimiter(cfg.Concurrency, app)
+	deadlineLimiter := middleware.NewDeadlineLimiter(cfg.Deadlines, app)
+
+	var recordTo io.Writer
+	if cfg.Record.Path != "" {
+		f, err := os.OpenFile(cfg.Record.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return startup.Record.Wrap(err)
+		}
+		defer f.Close()
+		recordTo = f
+	}
+	recorder := recording.NewRecorder(recordTo, cfg.Record, log.Warnf)
+
+	opts := append(transport.ServerOptions(cfg.Transport),
+		grpc.Creds(tlsCredentials),
+		grpc.ChainUnaryInterceptor(middleware.UnaryRequestID(log), middleware.UnaryRecovery(log, app), deadlineLimiter.Unary(), skipHealth(middleware.UnaryAuthorizer(authorizer)), skipHealth(recorder.Unary()), rateLimiter.Unary(), concurrencyLimiter.Unary(), middleware.UnaryValidator(), nrgrpc.UnaryServerInterceptor(app), middleware.UnaryRequestIDAttribute()),
+		grpc.ChainStreamInterceptor(middleware.StreamRequestID(log), middleware.StreamRecovery(log, app), deadlineLimiter.Stream(), rateLimiter.Stream(), concurrencyLimiter.Stream(), middleware.StreamValidator()),
+	)
+	s := mesh.NewServer(log, cfg.XDS, opts...)
+	v1 := &server{}
+	hellov1.RegisterHelloServiceServer(s, v1)
+	pb.RegisterHelloServiceServer(s, &legacyServer{v1: v1})
+	hellov1.RegisterCreateUserServiceServer(s, users.NewServer())
+	healthpb.RegisterHealthServer(s, healthServer)
+
+	if cfg.AdminAddr != "" {
+		adminServer, cleanup, err := serveAdmin(log, cfg.AdminAddr, cfg.AdminToken, tlsCredentials, s)
+		if err != nil {
+			return startup.Listen.Wrap(err)
+		}
+		defer cleanup()
+		defer adminServer.Stop()
+	}
+
+	// TLS material and JWKS are loaded at this point, so report every
+	// registered service as ready.
+	for name := range s.GetServiceInfo() {
+		healthServer.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+	}
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+
+	var webServer *http.Server
+	if cfg.Web.Enabled {
+		// ValidateServer rules out xDS in web mode, so s is a *grpc.Server.
+		webServer, err = newWebServer(s.(*grpc.Server), cfg, tlsConfig)
+		if err != nil {
+			return startup.Listen.Wrap(err)
+		}
+	}
+
+	serveErr := make(chan error, len(listeners))
+	for _, lis := range listeners {
+		log.Infof("serving on %s %s", lis.Addr().Network(), lis.Addr())
+		go func(lis net.Listener) {
+			if webServer != nil {
+				serveErr <- webServer.ServeTLS(lis, "", "")
+				return
+			}
+			serveErr <- s.Serve(lis)
+		}(lis)
+	}
+
+	var gatewayServer *http.Server
+	if cfg.GatewayAddr != "" {
+		gatewayServer, err = serveGateway(ctx, log, cfg.GatewayAddr, localTarget(cfg), cert)
+		if err != nil {
+			s.Stop()
+			return startup.Listen.Wrap(err)
+		}
 	}
 
-	s := grpc.NewServer(grpc.Creds(tlsCredentials), grpc.ChainUnaryInterceptor(authorizer.EnsureValidToken, nrgrpc.UnaryServerInterceptor(app)))
-	pb.RegisterHelloServiceServer(s, &server{})
+	select {
+	case err = <-serveErr:
+		err = fmt.Errorf("failed to serve: %w", err)
+	case <-ctx.Done():
+		log.Info("shutdown signal received, draining connections")
+	}
 
-	if err := s.Serve(lis); err != nil {
-		log.Printf("failed to serve: %s", err)
+	sequence := &shutdown.Sequence{
+		Log:        log,
+		Health:     healthServer,
+		DrainDelay: cfg.DrainDelay,
+		Timeout:    cfg.ShutdownTimeout,
+		Gateway:    gatewayServer,
+		Web:        webServer,
+		GRPC:       s,
 	}
+	sequence.Run()
+
+	log.Info("server stopped")
+	return err
 }
 
-func (s *server) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloRequest, error) {
-	fmt.Printf("Received: %v\n", in.GetName())
+func (s *server) SayHello(ctx context.Context, in *hellov1.HelloRequest) (*hellov1.HelloResponse, error) {
+	middleware.Logger(ctx).WithField("name", in.GetName()).Info("received hello")
 
-	hostname, _ := os.Hostname()
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, middleware.Status(codes.Internal, "failed to resolve hostname", middleware.ReasonInternal, nil).Err()
+	}
 	app.RecordCustomMetric("SayHello", 1)
-	return &pb.HelloRequest{Name: hostname}, nil
+	return &hellov1.HelloResponse{
+		Greeting:   "Hello " + in.GetName(),
+		ServedBy:   hostname,
+		ServerTime: timestamppb.Now(),
+	}, nil
+}
+
+// SayHello answers with the serving host name in place of a response
+// message, as the unversioned API always has.
+func (s *legacyServer) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloRequest, error) {
+	app.RecordCustomMetric("SayHelloDeprecated", 1)
+	resp, err := s.v1.SayHello(ctx, &hellov1.HelloRequest{Name: in.GetName()})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.HelloRequest{Name: resp.GetServedBy()}, nil
+}
+
+// serveHealth exposes the health service on a separate plaintext port so that
+// kubelet gRPC probes, which cannot present a client certificate, can reach it.
+func serveHealth(log *logrus.Logger, addr string, healthServer *health.Server) (*grpc.Server, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for health checks: %w", err)
+	}
+
+	s := grpc.NewServer()
+	healthpb.RegisterHealthServer(s, healthServer)
+
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Errorf("failed to serve health checks: %s", err)
+		}
+	}()
+	return s, nil
+}
+
+// serveGateway serves the REST/JSON gateway over HTTPS on addr, proxying to
+// the gRPC server at target over mutual TLS with the server's own
+// certificate. Bearer tokens are forwarded, so requests are authorized by the
+// gRPC server exactly as native calls are.
+func serveGateway(ctx context.Context, log *logrus.Logger, addr, target string, cert *pki.Certificate) (*http.Server, error) {
+	clientTLS, err := cert.TLSConfig(certutil.TLSClient)
+	if err != nil {
+		return nil, err
+	}
+	serverTLS, err := cert.TLSConfig(certutil.TLSServer)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.DialContext(ctx, target, grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial gRPC server for gateway: %w", err)
+	}
+
+	handler, err := gateway.New(ctx, conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to register gateway handlers: %w", err)
+	}
+
+	lis, err := tls.Listen("tcp", addr, serverTLS)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to listen for gateway: %w", err)
+	}
+
+	srv := &http.Server{Handler: handler}
+	srv.RegisterOnShutdown(func() {
+		conn.Close()
+	})
+	go func() {
+		if err := srv.Serve(lis); err != nil && err != http.ErrServerClosed {
+			log.Errorf("failed to serve gateway: %s", err)
+		}
+	}()
+	return srv, nil
+}
+
+// newWebServer returns an HTTP/2 server handing native gRPC, gRPC-Web and
+// Connect requests to s. Client certificates become optional at the TLS
+// layer so browsers can connect; the web handler still demands one for
+// native gRPC calls.
+func newWebServer(s *grpc.Server, cfg *config.Config, tlsConfig *tls.Config) (*http.Server, error) {
+	webTLS := tlsConfig.Clone()
+	webTLS.ClientAuth = tls.VerifyClientCertIfGiven
+
+	srv := &http.Server{
+		Handler:   web.NewHandler(s, cfg.Web, cfg.Transport.MaxRecvMsgSize),
+		TLSConfig: webTLS,
+	}
+	err := http2.ConfigureServer(srv, &http2.Server{
+		MaxConcurrentStreams: uint32(cfg.Transport.MaxConcurrentStreams),
+		IdleTimeout:          cfg.Transport.MaxConnectionIdle,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure HTTP/2: %w", err)
+	}
+	return srv, nil
+}
+
+// localTarget returns the address at which this process' gRPC server can be
+// reached, with a host name covered by the issued certificate.
+func localTarget(cfg *config.Config) string {
+	if cfg.ListenAddr == "" {
+		return "unix://" + cfg.UnixSocket
+	}
+	_, port, _ := net.SplitHostPort(cfg.ListenAddr)
+	return net.JoinHostPort("localhost", port)
+}
+
+// serveAdmin exposes reflection for the services of main, and channelz, on
+// their own listener so they are never reachable through the public port.
+// Callers need a client certificate and the admin bearer token.
+func serveAdmin(log *logrus.Logger, addr, token string, creds credentials.TransportCredentials, main mesh.Server) (*grpc.Server, func(), error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to listen for admin services: %w", err)
+	}
+
+	s, cleanup, err := admin.NewServer(token, main, grpc.Creds(creds))
+	if err != nil {
+		lis.Close()
+		return nil, nil, err
+	}
+
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Errorf("failed to serve admin services: %s", err)
+		}
+	}()
+	return s, cleanup, nil
 }
 
-func MustMapEnv(key string) string {
-	env := os.Getenv(key)
-	if env == "" {
-		panic(fmt.Sprintf("environment variable %s not set", key))
+// skipHealth wraps interceptor so that health checks on the mTLS port do not
+// require a bearer token.
+func skipHealth(interceptor grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if strings.HasPrefix(info.FullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/") {
+			return handler(ctx, req)
+		}
+		return interceptor(ctx, req, info, handler)
 	}
-	return env
 }
@@ -3,7 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
-	pb "github.com/jamiewhitney/grpc-go-vault/hello"
+	pb "github.com/jamiewhitney/grpc-go-vault/hello/v1"
 	"google.golang.org/grpc"
 	"testing"
 )
@@ -49,8 +49,8 @@ func TestMessages(t *testing.T) {
 		if err != nil {
 			t.Errorf("HelloTest(%v) got unexpected error", err)
 		}
-		if resp.Name != tt.want {
-			t.Errorf("HelloText(%v)=%v, wanted %v", tt.name, resp.Name, tt.want)
+		if resp.GetGreeting() != tt.want {
+			t.Errorf("HelloText(%v)=%v, wanted %v", tt.name, resp.GetGreeting(), tt.want)
 		}
 	}
 }
@@ -0,0 +1,349 @@
+package serviceconfig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jamiewhitney/grpc-go-vault/middleware"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// HedgingPolicy is the hedgingPolicy of a method config: up to MaxAttempts
+// copies of a call are sent, each HedgingDelay after the previous one or
+// straight after an attempt fails with one of NonFatalCodes. The first
+// other result wins and the remaining attempts are cancelled.
+type HedgingPolicy struct {
+	MaxAttempts   int
+	HedgingDelay  time.Duration
+	NonFatalCodes []codes.Code
+}
+
+// Throttling is the retryThrottling of a service config. Every failed attempt
+// takes a token from a bucket of MaxTokens and every successful one returns
+// TokenRatio of a token; further attempts are only sent while more than half
+// the tokens are left.
+type Throttling struct {
+	MaxTokens  float64
+	TokenRatio float64
+}
+
+type jsonServiceConfig struct {
+	MethodConfig []struct {
+		Name []struct {
+			Service string `json:"service"`
+			Method  string `json:"method"`
+		} `json:"name"`
+		HedgingPolicy *struct {
+			MaxAttempts         int          `json:"maxAttempts"`
+			HedgingDelay        string       `json:"hedgingDelay"`
+			NonFatalStatusCodes []codes.Code `json:"nonFatalStatusCodes"`
+		} `json:"hedgingPolicy"`
+	} `json:"methodConfig"`
+	RetryThrottling *struct {
+		MaxTokens  float64 `json:"maxTokens"`
+		TokenRatio float64 `json:"tokenRatio"`
+	} `json:"retryThrottling"`
+}
+
+// maxHedgingAttempts caps maxAttempts as gRPC does for retries and hedging.
+const maxHedgingAttempts = 5
+
+// HedgingPolicies returns the hedging policies in serviceConfig keyed by the
+// method name they apply to, in the form "/service/method", "/service/" for
+// every method of a service or "" for every method.
+func HedgingPolicies(serviceConfig string) (map[string]HedgingPolicy, error) {
+	var sc jsonServiceConfig
+	if err := json.Unmarshal([]byte(serviceConfig), &sc); err != nil {
+		return nil, fmt.Errorf("invalid service config: %w", err)
+	}
+
+	policies := map[string]HedgingPolicy{}
+	for _, mc := range sc.MethodConfig {
+		if mc.HedgingPolicy == nil {
+			continue
+		}
+		if mc.HedgingPolicy.MaxAttempts < 2 {
+			return nil, fmt.Errorf("hedging policy needs maxAttempts of at least 2")
+		}
+		policy := HedgingPolicy{
+			MaxAttempts:   mc.HedgingPolicy.MaxAttempts,
+			NonFatalCodes: mc.HedgingPolicy.NonFatalStatusCodes,
+		}
+		if policy.MaxAttempts > maxHedgingAttempts {
+			policy.MaxAttempts = maxHedgingAttempts
+		}
+		if mc.HedgingPolicy.HedgingDelay != "" {
+			delay, err := time.ParseDuration(mc.HedgingPolicy.HedgingDelay)
+			if err != nil {
+				return nil, fmt.Errorf("invalid hedging delay: %w", err)
+			}
+			policy.HedgingDelay = delay
+		}
+
+		for _, name := range mc.Name {
+			key := ""
+			if name.Service != "" {
+				key = "/" + name.Service + "/" + name.Method
+			}
+			policies[key] = policy
+		}
+	}
+	return policies, nil
+}
+
+// RetryThrottling returns the retry throttling in serviceConfig, or nil if
+// it declares none.
+func RetryThrottling(serviceConfig string) (*Throttling, error) {
+	var sc jsonServiceConfig
+	if err := json.Unmarshal([]byte(serviceConfig), &sc); err != nil {
+		return nil, fmt.Errorf("invalid service config: %w", err)
+	}
+	rt := sc.RetryThrottling
+	if rt == nil {
+		return nil, nil
+	}
+	if rt.MaxTokens <= 0 || rt.MaxTokens > 1000 {
+		return nil, fmt.Errorf("retry throttling needs maxTokens between 0 and 1000")
+	}
+	if rt.TokenRatio <= 0 {
+		return nil, fmt.Errorf("retry throttling needs a positive tokenRatio")
+	}
+	return &Throttling{MaxTokens: rt.MaxTokens, TokenRatio: rt.TokenRatio}, nil
+}
+
+// throttle is the token bucket of a Throttling. A nil throttle never
+// throttles.
+type throttle struct {
+	cfg Throttling
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+func newThrottle(cfg *Throttling) *throttle {
+	if cfg == nil {
+		return nil
+	}
+	return &throttle{cfg: *cfg, tokens: cfg.MaxTokens}
+}
+
+func (t *throttle) allow() bool {
+	if t == nil {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tokens > t.cfg.MaxTokens/2
+}
+
+func (t *throttle) failure() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tokens = math.Max(t.tokens-1, 0)
+}
+
+func (t *throttle) success() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tokens = math.Min(t.tokens+t.cfg.TokenRatio, t.cfg.MaxTokens)
+}
+
+// Hedger applies hedging policies to unary calls, which gRPC itself does not
+// implement. Hedged attempts go through the rest of the interceptor chain
+// and any retry policy separately, so a method should have one policy or the
+// other. Attempts after the first carry the number of earlier attempts in
+// the "grpc-previous-rpc-attempts" header.
+//
+// So that hedging cannot multiply the load on a struggling server, no
+// further attempts of a call are sent once one fails with server pushback
+// ("grpc-retry-pushback-ms") or an OVERLOADED ErrorInfo, nor while the
+// throttling bucket is at half or less.
+type Hedger struct {
+	policies map[string]HedgingPolicy
+	throttle *throttle
+	app      *newrelic.Application
+
+	attempts  int64
+	hedged    int64
+	cancelled int64
+	throttled int64
+}
+
+// NewHedger creates a Hedger applying policies as returned by
+// HedgingPolicies, throttled by throttling as returned by RetryThrottling.
+func NewHedger(policies map[string]HedgingPolicy, throttling *Throttling, app *newrelic.Application) *Hedger {
+	return &Hedger{policies: policies, throttle: newThrottle(throttling), app: app}
+}
+
+// Attempts returns the number of attempts sent by hedged calls so far.
+func (h *Hedger) Attempts() int64 { return atomic.LoadInt64(&h.attempts) }
+
+// Hedged returns the number of attempts sent in addition to the first.
+func (h *Hedger) Hedged() int64 { return atomic.LoadInt64(&h.hedged) }
+
+// Throttled returns the number of attempts not sent because of pushback,
+// overload or throttling.
+func (h *Hedger) Throttled() int64 { return atomic.LoadInt64(&h.throttled) }
+
+// Cancelled returns the number of attempts cancelled because another
+// attempt of the same call had already finished.
+func (h *Hedger) Cancelled() int64 { return atomic.LoadInt64(&h.cancelled) }
+
+// Unary returns a client interceptor hedging calls to methods with a policy.
+// CallOptions are passed to every attempt, so options capturing headers or
+// trailers should not be used with hedged methods.
+func (h *Hedger) Unary() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		policy, ok := h.policy(method)
+		replyMsg, isProto := reply.(proto.Message)
+		if !ok || !isProto {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		return h.hedge(ctx, policy, method, req, replyMsg, cc, invoker, opts)
+	}
+}
+
+func (h *Hedger) policy(method string) (HedgingPolicy, bool) {
+	if p, ok := h.policies[method]; ok {
+		return p, true
+	}
+	if i := strings.LastIndex(method, "/"); i > 0 {
+		if p, ok := h.policies[method[:i+1]]; ok {
+			return p, true
+		}
+	}
+	p, ok := h.policies[""]
+	return p, ok
+}
+
+type attemptResult struct {
+	reply   proto.Message
+	trailer metadata.MD
+	err     error
+}
+
+func (h *Hedger) hedge(ctx context.Context, policy HedgingPolicy, method string, req interface{}, reply proto.Message, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts []grpc.CallOption) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan attemptResult, policy.MaxAttempts)
+	started, pending := 0, 0
+	var nextAttempt <-chan time.Time
+	start := func() {
+		attemptCtx := ctx
+		if started > 0 {
+			attemptCtx = metadata.AppendToOutgoingContext(ctx, "grpc-previous-rpc-attempts", strconv.Itoa(started))
+			atomic.AddInt64(&h.hedged, 1)
+			h.app.RecordCustomMetric("HedgedAttempts", 1)
+		}
+		started++
+		pending++
+		atomic.AddInt64(&h.attempts, 1)
+
+		attemptReply := reply.ProtoReflect().New().Interface()
+		go func() {
+			var trailer metadata.MD
+			err := invoker(attemptCtx, method, req, attemptReply, cc, append(opts, grpc.Trailer(&trailer))...)
+			results <- attemptResult{reply: attemptReply, trailer: trailer, err: err}
+		}()
+
+		nextAttempt = nil
+		if started < policy.MaxAttempts {
+			nextAttempt = time.After(policy.HedgingDelay)
+		}
+	}
+
+	// throttle stops the call sending any more attempts.
+	throttle := func() {
+		nextAttempt = nil
+		n := policy.MaxAttempts - started
+		started = policy.MaxAttempts
+		atomic.AddInt64(&h.throttled, int64(n))
+		h.app.RecordCustomMetric("HedgeThrottled", float64(n))
+	}
+
+	start()
+	for {
+		select {
+		case <-nextAttempt:
+			if h.throttle.allow() {
+				start()
+			} else {
+				throttle()
+			}
+		case res := <-results:
+			pending--
+			if res.err != nil && nonFatal(policy, res.err) {
+				h.throttle.failure()
+				if started < policy.MaxAttempts {
+					if pushedBack(res) || !h.throttle.allow() {
+						throttle()
+					} else {
+						start()
+					}
+				}
+				if pending == 0 && started == policy.MaxAttempts {
+					return res.err
+				}
+				continue
+			}
+			if res.err == nil {
+				h.throttle.success()
+			}
+
+			// The deferred cancel stops the attempts still in flight.
+			if pending > 0 {
+				atomic.AddInt64(&h.cancelled, int64(pending))
+				h.app.RecordCustomMetric("HedgeCancelled", float64(pending))
+			}
+			if res.err == nil {
+				proto.Reset(reply)
+				proto.Merge(reply, res.reply)
+			}
+			return res.err
+		}
+	}
+}
+
+// pushedBack reports whether the server asked for no further attempts, by
+// pushback or by reporting it is overloaded.
+func pushedBack(res attemptResult) bool {
+	if len(res.trailer.Get("grpc-retry-pushback-ms")) > 0 {
+		return true
+	}
+	for _, detail := range status.Convert(res.err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.GetDomain() == middleware.ErrorDomain && info.GetReason() == middleware.ReasonOverloaded {
+			return true
+		}
+	}
+	return false
+}
+
+func nonFatal(policy HedgingPolicy, err error) bool {
+	code := status.Code(err)
+	for _, c := range policy.NonFatalCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+// Package serviceconfig provides the gRPC service config clients dial with,
+// declaring waitForReady and retry or hedging policies per method,
+// and applies the hedging policies gRPC itself ignores.
+package serviceconfig
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Default retries calls failing with UNAVAILABLE, which covers a server pod
+// restarting, throttling retries once more than a tenth of recent calls have
+// failed so that an outage does not multiply the load on the server. The
+// idempotent, latency-sensitive SayHello is hedged instead: a second copy is
+// sent if the first has not answered within 200ms, and a third after as long
+// again, with UNAVAILABLE and ABORTED moving on to the next attempt at once
+// unless the server pushes back or reports it is overloaded. Hedged attempts
+// are throttled like retries.
+//
+//go:embed default.json
+var Default string
+
+// Load returns the service config in the file at path, or Default when path
+// is empty.
+func Load(path string) (string, error) {
+	if path == "" {
+		return Default, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if !json.Valid(b) {
+		return "", fmt.Errorf("service config %s is not valid JSON", path)
+	}
+	return string(b), nil
+}
+
+// WithLoadBalancing returns serviceConfig selecting policy as its load
+// balancing policy, unless serviceConfig already declares one or policy is
+// empty.
+func WithLoadBalancing(serviceConfig, policy string) (string, error) {
+	if policy == "" {
+		return serviceConfig, nil
+	}
+
+	var sc map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(serviceConfig), &sc); err != nil {
+		return "", fmt.Errorf("service config is not a JSON object: %w", err)
+	}
+	if _, ok := sc["loadBalancingConfig"]; ok {
+		return serviceConfig, nil
+	}
+	if _, ok := sc["loadBalancingPolicy"]; ok {
+		return serviceConfig, nil
+	}
+
+	lb, err := json.Marshal([]map[string]struct{}{{policy: {}}})
+	if err != nil {
+		return "", err
+	}
+	sc["loadBalancingConfig"] = lb
+	b, err := json.Marshal(sc)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,348 @@
+package serviceconfig
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/jamiewhitney/grpc-go-vault/hello/v1"
+	"github.com/jamiewhitney/grpc-go-vault/internal/testutil"
+	"github.com/jamiewhitney/grpc-go-vault/middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// flakyServer fails the first failures calls with code, and makes every call
+// whose attempt number is listed in slow wait until it is cancelled. With
+// overloaded set it fails them as the server's load shedding does instead,
+// and with pushback set it asks for no further attempts.
+type flakyServer struct {
+	pb.UnimplementedHelloServiceServer
+	pb.UnimplementedCreateUserServiceServer
+	code       codes.Code
+	failures   int32
+	slow       map[int32]bool
+	overloaded bool
+	pushback   bool
+
+	calls     int32
+	cancelled int32
+}
+
+func (s *flakyServer) call(ctx context.Context) error {
+	n := atomic.AddInt32(&s.calls, 1)
+	if s.slow[n] {
+		<-ctx.Done()
+		if status.FromContextError(ctx.Err()).Code() == codes.Canceled {
+			atomic.AddInt32(&s.cancelled, 1)
+		}
+		return ctx.Err()
+	}
+	if n <= s.failures {
+		if s.pushback {
+			grpc.SetTrailer(ctx, metadata.Pairs("grpc-retry-pushback-ms", "-1"))
+		}
+		if s.overloaded {
+			return middleware.Status(codes.Unavailable, "server overloaded", middleware.ReasonOverloaded, nil).Err()
+		}
+		return status.Error(s.code, "try again")
+	}
+	return nil
+}
+
+func (s *flakyServer) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloResponse, error) {
+	if err := s.call(ctx); err != nil {
+		return nil, err
+	}
+	return &pb.HelloResponse{Greeting: "Hello " + in.GetName()}, nil
+}
+
+func (s *flakyServer) CreateUser(ctx context.Context, in *pb.CreateUserRequest) (*pb.CreateUserResponse, error) {
+	if err := s.call(ctx); err != nil {
+		return nil, err
+	}
+	return &pb.CreateUserResponse{Id: in.GetId()}, nil
+}
+
+func dial(t *testing.T, srv *flakyServer, serviceConfig string, opts ...grpc.DialOption) *grpc.ClientConn {
+	t.Helper()
+
+	s := grpc.NewServer()
+	pb.RegisterHelloServiceServer(s, srv)
+	pb.RegisterCreateUserServiceServer(s, srv)
+	return testutil.Dial(t, s, append(opts, grpc.WithDefaultServiceConfig(serviceConfig))...)
+}
+
+func TestDefaultRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		code      codes.Code
+		failures  int32
+		want      codes.Code
+		wantCalls int32
+	}{
+		{"recovers from unavailable", codes.Unavailable, 2, codes.OK, 3},
+		{"gives up after max attempts", codes.Unavailable, 3, codes.Unavailable, 3},
+		{"does not retry internal", codes.Internal, 1, codes.Internal, 1},
+	}
+
+	for _, tt := range tests {
+		srv := &flakyServer{code: tt.code, failures: tt.failures}
+		c := pb.NewCreateUserServiceClient(dial(t, srv, Default))
+
+		_, err := c.CreateUser(context.Background(), &pb.CreateUserRequest{Id: "jamie", Name: "Jamie"})
+		if got := status.Code(err); got != tt.want {
+			t.Errorf("%s: CreateUser() got code %s, wanted %s", tt.name, got, tt.want)
+		}
+		if got := atomic.LoadInt32(&srv.calls); got != tt.wantCalls {
+			t.Errorf("%s: CreateUser() made %d calls, wanted %d", tt.name, got, tt.wantCalls)
+		}
+	}
+}
+
+func TestDefaultHedging(t *testing.T) {
+	policies, err := HedgingPolicies(Default)
+	if err != nil {
+		t.Fatalf("HedgingPolicies() got unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		srv           *flakyServer
+		want          codes.Code
+		wantCalls     int32
+		wantCancelled int32
+	}{
+		{"fast first attempt is not hedged", &flakyServer{}, codes.OK, 1, 0},
+		{"slow first attempt is hedged and cancelled", &flakyServer{slow: map[int32]bool{1: true}}, codes.OK, 2, 1},
+		{"two slow attempts", &flakyServer{slow: map[int32]bool{1: true, 2: true}}, codes.OK, 3, 2},
+		{"unavailable moves on at once", &flakyServer{code: codes.Unavailable, failures: 2}, codes.OK, 3, 0},
+		{"gives up after max attempts", &flakyServer{code: codes.Unavailable, failures: 3}, codes.Unavailable, 3, 0},
+		{"fatal code ends the call", &flakyServer{code: codes.Internal, failures: 1}, codes.Internal, 1, 0},
+	}
+
+	for _, tt := range tests {
+		hedger := NewHedger(policies, nil, nil)
+		c := pb.NewHelloServiceClient(dial(t, tt.srv, Default, grpc.WithUnaryInterceptor(hedger.Unary())))
+
+		start := time.Now()
+		resp, err := c.SayHello(context.Background(), &pb.HelloRequest{Name: "world"})
+		elapsed := time.Since(start)
+		if got := status.Code(err); got != tt.want {
+			t.Errorf("%s: SayHello() got code %s, wanted %s", tt.name, got, tt.want)
+		}
+		if err == nil && resp.GetGreeting() != "Hello world" {
+			t.Errorf("%s: SayHello() got greeting %q, wanted %q", tt.name, resp.GetGreeting(), "Hello world")
+		}
+		// Slow attempts never answer, so a call only returns in time if a
+		// hedged attempt answered for it.
+		if elapsed > time.Second {
+			t.Errorf("%s: SayHello() took %s", tt.name, elapsed)
+		}
+
+		if got := hedger.Attempts(); got != int64(tt.wantCalls) {
+			t.Errorf("%s: hedger sent %d attempts, wanted %d", tt.name, got, tt.wantCalls)
+		}
+		if got := hedger.Cancelled(); got != int64(tt.wantCancelled) {
+			t.Errorf("%s: hedger cancelled %d attempts, wanted %d", tt.name, got, tt.wantCancelled)
+		}
+		waitFor(t, func() bool { return atomic.LoadInt32(&tt.srv.cancelled) == tt.wantCancelled })
+		if got := atomic.LoadInt32(&tt.srv.cancelled); got != tt.wantCancelled {
+			t.Errorf("%s: server saw %d attempts cancelled, wanted %d", tt.name, got, tt.wantCancelled)
+		}
+		if got := atomic.LoadInt32(&tt.srv.calls); got != tt.wantCalls {
+			t.Errorf("%s: server got %d attempts, wanted %d", tt.name, got, tt.wantCalls)
+		}
+	}
+}
+
+func TestHedgingBacksOff(t *testing.T) {
+	policies, err := HedgingPolicies(Default)
+	if err != nil {
+		t.Fatalf("HedgingPolicies() got unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		srv           *flakyServer
+		wantCalls     int32
+		wantThrottled int64
+	}{
+		{"load shedding", &flakyServer{code: codes.Unavailable, failures: 3, overloaded: true}, 1, 2},
+		{"pushback", &flakyServer{code: codes.Unavailable, failures: 3, pushback: true}, 1, 2},
+	}
+	for _, tt := range tests {
+		hedger := NewHedger(policies, nil, nil)
+		c := pb.NewHelloServiceClient(dial(t, tt.srv, Default, grpc.WithUnaryInterceptor(hedger.Unary())))
+
+		if _, err := c.SayHello(context.Background(), &pb.HelloRequest{Name: "world"}); status.Code(err) != codes.Unavailable {
+			t.Errorf("%s: SayHello() got error %v, wanted code %s", tt.name, err, codes.Unavailable)
+		}
+		if got := atomic.LoadInt32(&tt.srv.calls); got != tt.wantCalls {
+			t.Errorf("%s: server got %d attempts, wanted %d", tt.name, got, tt.wantCalls)
+		}
+		if got := hedger.Throttled(); got != tt.wantThrottled {
+			t.Errorf("%s: hedger throttled %d attempts, wanted %d", tt.name, got, tt.wantThrottled)
+		}
+	}
+}
+
+func TestHedgingThrottling(t *testing.T) {
+	policies, err := HedgingPolicies(Default)
+	if err != nil {
+		t.Fatalf("HedgingPolicies() got unexpected error: %v", err)
+	}
+	throttling, err := RetryThrottling(`{"retryThrottling": {"maxTokens": 4, "tokenRatio": 0.5}}`)
+	if err != nil {
+		t.Fatalf("RetryThrottling() got unexpected error: %v", err)
+	}
+	hedger := NewHedger(policies, throttling, nil)
+	srv := &flakyServer{code: codes.Unavailable, failures: 5}
+	c := pb.NewHelloServiceClient(dial(t, srv, Default, grpc.WithUnaryInterceptor(hedger.Unary())))
+
+	// 4 tokens: the first call fails twice, leaving 2, which is too few for
+	// the second call to be hedged at all
+	tests := []struct {
+		want      codes.Code
+		wantCalls int32
+	}{
+		{codes.Unavailable, 2},
+		{codes.Unavailable, 3},
+		{codes.Unavailable, 4},
+		{codes.Unavailable, 5},
+		{codes.OK, 6},
+	}
+	for i, tt := range tests {
+		_, err := c.SayHello(context.Background(), &pb.HelloRequest{Name: "world"})
+		if got := status.Code(err); got != tt.want {
+			t.Errorf("call %d: SayHello() got code %s, wanted %s", i, got, tt.want)
+		}
+		if got := atomic.LoadInt32(&srv.calls); got != tt.wantCalls {
+			t.Errorf("call %d: server got %d attempts in all, wanted %d", i, got, tt.wantCalls)
+		}
+	}
+
+	for _, sc := range []string{`{"retryThrottling": {"maxTokens": 0, "tokenRatio": 0.1}}`, `{"retryThrottling": {"maxTokens": 10}}`} {
+		if _, err := RetryThrottling(sc); err == nil {
+			t.Errorf("RetryThrottling(%s) got no error", sc)
+		}
+	}
+	if got, err := RetryThrottling(`{}`); got != nil || err != nil {
+		t.Errorf("RetryThrottling() without throttling got %v, %v, wanted nil", got, err)
+	}
+}
+
+func TestHedgingPolicies(t *testing.T) {
+	policies, err := HedgingPolicies(`{"methodConfig": [
+		{"name": [{}], "hedgingPolicy": {"maxAttempts": 9, "hedgingDelay": "1s"}},
+		{"name": [{"service": "a.Service"}], "hedgingPolicy": {"maxAttempts": 2, "nonFatalStatusCodes": ["UNAVAILABLE"]}},
+		{"name": [{"service": "a.Service", "method": "Retried"}], "retryPolicy": {}}
+	]}`)
+	if err != nil {
+		t.Fatalf("HedgingPolicies() got unexpected error: %v", err)
+	}
+
+	h := NewHedger(policies, nil, nil)
+	tests := []struct {
+		method       string
+		wantAttempts int
+	}{
+		{"/a.Service/Method", 2},
+		{"/b.Service/Method", maxHedgingAttempts},
+	}
+	for _, tt := range tests {
+		policy, ok := h.policy(tt.method)
+		if !ok || policy.MaxAttempts != tt.wantAttempts {
+			t.Errorf("policy(%s) got %+v, wanted %d attempts", tt.method, policy, tt.wantAttempts)
+		}
+	}
+	if got := policies["/a.Service/"].NonFatalCodes; len(got) != 1 || got[0] != codes.Unavailable {
+		t.Errorf("HedgingPolicies() got non-fatal codes %v, wanted [Unavailable]", got)
+	}
+
+	if _, err := HedgingPolicies(`{"methodConfig": [{"name": [{}], "hedgingPolicy": {"maxAttempts": 1}}]}`); err == nil {
+		t.Errorf("HedgingPolicies() with a single attempt got no error")
+	}
+}
+
+// waitFor polls cond for up to a second, as the server only notices
+// cancellation once the client's RST_STREAM arrives.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.json")
+	if err := os.WriteFile(valid, []byte(`{"methodConfig": []}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`{"methodConfig": [`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{"", Default, false},
+		{valid, `{"methodConfig": []}`, false},
+		{invalid, "", true},
+		{filepath.Join(dir, "missing.json"), "", true},
+	}
+	for _, tt := range tests {
+		got, err := Load(tt.path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Load(%q) got error %v, wanted error %t", tt.path, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("Load(%q) got %q, wanted %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestWithLoadBalancing(t *testing.T) {
+	tests := []struct {
+		name          string
+		serviceConfig string
+		policy        string
+		want          string
+	}{
+		{"adds policy", `{"methodConfig":[]}`, "round_robin", `{"loadBalancingConfig":[{"round_robin":{}}],"methodConfig":[]}`},
+		{"keeps declared config", `{"loadBalancingConfig":[{"pick_first":{}}]}`, "round_robin", `{"loadBalancingConfig":[{"pick_first":{}}]}`},
+		{"keeps declared policy", `{"loadBalancingPolicy":"pick_first"}`, "round_robin", `{"loadBalancingPolicy":"pick_first"}`},
+		{"no policy", `{"methodConfig":[]}`, "", `{"methodConfig":[]}`},
+	}
+	for _, tt := range tests {
+		got, err := WithLoadBalancing(tt.serviceConfig, tt.policy)
+		if err != nil {
+			t.Errorf("%s: WithLoadBalancing() got unexpected error: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: WithLoadBalancing() got %s, wanted %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultWithRoundRobin(t *testing.T) {
+	sc, err := WithLoadBalancing(Default, "round_robin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := pb.NewHelloServiceClient(dial(t, &flakyServer{}, sc))
+	if _, err := c.SayHello(context.Background(), &pb.HelloRequest{Name: "world"}); err != nil {
+		t.Errorf("SayHello() got unexpected error: %v", err)
+	}
+}
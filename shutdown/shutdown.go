@@ -0,0 +1,103 @@
+// Package shutdown stops the server in an order that lets load balancers and
+// clients move away before connections are closed.
+package shutdown
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/health"
+)
+
+// NotifyContext returns a context that is cancelled when the process receives
+// one of signals. Once the first signal starts the graceful shutdown, the
+// default handling is restored so that a second one kills the process at
+// once.
+func NotifyContext(parent context.Context, signals ...os.Signal) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(parent, signals...)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+// Server is the part of a gRPC server used to stop it.
+type Server interface {
+	GracefulStop()
+	Stop()
+}
+
+// Sequence holds what is stopped when the server shuts down. Unset fields are
+// skipped.
+type Sequence struct {
+	Log logrus.FieldLogger
+
+	// Health reports every service as NOT_SERVING for DrainDelay before
+	// anything is stopped, so that probes and load balancers take the
+	// server out of rotation while it still answers.
+	Health     *health.Server
+	DrainDelay time.Duration
+
+	// Timeout bounds each of the steps waiting for in-flight requests.
+	Timeout time.Duration
+
+	Gateway *http.Server
+	// Web, when set, serves every call of GRPC through its ServeHTTP.
+	// grpc.Server cannot drain those connections and panics when asked to,
+	// so GRPC is stopped outright once Web has shut down.
+	Web  *http.Server
+	GRPC Server
+}
+
+// Run fails the health checks, waits for the drain delay, then stops the
+// HTTP servers and finally the gRPC server, giving each up to the timeout to
+// finish in-flight requests before closing their connections.
+func (s *Sequence) Run() {
+	if s.Health != nil {
+		s.Health.Shutdown()
+	}
+	time.Sleep(s.DrainDelay)
+
+	s.shutdownHTTP("gateway", s.Gateway)
+	s.shutdownHTTP("web server", s.Web)
+	switch {
+	case s.GRPC == nil:
+	case s.Web != nil:
+		s.GRPC.Stop()
+	default:
+		s.gracefulStop()
+	}
+}
+
+func (s *Sequence) shutdownHTTP(name string, srv *http.Server) {
+	if srv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		s.Log.Errorf("failed to shut down %s: %s", name, err)
+	}
+}
+
+// gracefulStop waits up to the timeout for in-flight RPCs to finish before
+// forcibly closing the remaining connections.
+func (s *Sequence) gracefulStop() {
+	stopped := make(chan struct{})
+	go func() {
+		s.GRPC.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(s.Timeout):
+		s.Log.Warnf("graceful stop did not complete within %s, forcing stop", s.Timeout)
+		s.GRPC.Stop()
+	}
+}
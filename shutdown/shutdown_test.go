@@ -0,0 +1,218 @@
+package shutdown
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// stuckServer never finishes a graceful stop, as when a client holds a stream
+// open.
+type stuckServer struct {
+	stopped chan struct{}
+}
+
+func (s *stuckServer) GracefulStop() {
+	<-s.stopped
+}
+
+func (s *stuckServer) Stop() {
+	close(s.stopped)
+}
+
+// stoppedServer records that it was stopped.
+type stoppedServer struct {
+	stopped chan struct{}
+}
+
+func (s *stoppedServer) GracefulStop() {
+	close(s.stopped)
+}
+
+func (s *stoppedServer) Stop() {}
+
+func TestRunFailsHealthChecksFirst(t *testing.T) {
+	log, _ := test.NewNullLogger()
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("hello.v1.HelloService", healthpb.HealthCheckResponse_SERVING)
+	srv := &stoppedServer{stopped: make(chan struct{})}
+	sequence := &Sequence{Log: log, Health: healthServer, DrainDelay: 200 * time.Millisecond, Timeout: time.Second, GRPC: srv}
+
+	go sequence.Run()
+	for _, service := range []string{"", "hello.v1.HelloService"} {
+		var got healthpb.HealthCheckResponse_ServingStatus
+		for deadline := time.Now().Add(100 * time.Millisecond); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			resp, err := healthServer.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+			if err != nil {
+				t.Fatalf("Check(%q) got unexpected error: %v", service, err)
+			}
+			if got = resp.GetStatus(); got == healthpb.HealthCheckResponse_NOT_SERVING {
+				break
+			}
+		}
+		if got != healthpb.HealthCheckResponse_NOT_SERVING {
+			t.Errorf("Check(%q) got %s during the drain delay, wanted %s", service, got, healthpb.HealthCheckResponse_NOT_SERVING)
+		}
+	}
+
+	select {
+	case <-srv.stopped:
+		t.Errorf("Run() stopped the server before the drain delay was over")
+	default:
+	}
+	select {
+	case <-srv.stopped:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Run() did not stop the server after the drain delay")
+	}
+}
+
+func TestRunForcesStop(t *testing.T) {
+	log, hook := test.NewNullLogger()
+	srv := &stuckServer{stopped: make(chan struct{})}
+	sequence := &Sequence{Log: log, Timeout: 10 * time.Millisecond, GRPC: srv}
+
+	done := make(chan struct{})
+	go func() {
+		sequence.Run()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Run() did not return after the timeout")
+	}
+
+	select {
+	case <-srv.stopped:
+	default:
+		t.Errorf("Run() did not stop the server")
+	}
+	if entry := hook.LastEntry(); entry == nil || entry.Message != "graceful stop did not complete within 10ms, forcing stop" {
+		t.Errorf("Run() logged %v, wanted the forced stop", entry)
+	}
+}
+
+// TestRunWebMode holds a stream open on a gRPC server reached through an
+// HTTP server, as in web mode, across the shutdown.
+func TestRunWebMode(t *testing.T) {
+	log, _ := test.NewNullLogger()
+	s := grpc.NewServer()
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(s, healthServer)
+	srv := httptest.NewUnstartedServer(s)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	conn, err := grpc.Dial(srv.Listener.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: roots})))
+	if err != nil {
+		t.Fatalf("did not connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	stream, err := healthpb.NewHealthClient(conn).Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Watch() got unexpected error: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Recv() got unexpected error: %v", err)
+	}
+
+	sequence := &Sequence{Log: log, Health: healthServer, Timeout: 50 * time.Millisecond, Web: srv.Config, GRPC: s}
+	done := make(chan struct{})
+	go func() {
+		sequence.Run()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Run() did not return")
+	}
+
+	for {
+		if _, err := stream.Recv(); err != nil {
+			if status.Code(err) == codes.OK {
+				t.Errorf("Recv() got %v, wanted the stream cut off", err)
+			}
+			break
+		}
+	}
+}
+
+// TestNotifyContext runs the test binary again as a child, which waits for the
+// first signal and then stays up as a draining server would. A second signal
+// must kill it.
+func TestNotifyContext(t *testing.T) {
+	if os.Getenv("SHUTDOWN_TEST_CHILD") == "1" {
+		ctx, stop := NotifyContext(context.Background(), syscall.SIGINT)
+		defer stop()
+		fmt.Println("ready")
+		<-ctx.Done()
+		fmt.Println("draining")
+		time.Sleep(10 * time.Second)
+		os.Exit(0)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestNotifyContext$")
+	cmd.Env = append(os.Environ(), "SHUTDOWN_TEST_CHILD=1")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	lines := bufio.NewScanner(out)
+	waitFor := func(want string) {
+		for lines.Scan() {
+			if lines.Text() == want {
+				return
+			}
+		}
+		cmd.Process.Kill()
+		t.Fatalf("child exited before printing %q", want)
+	}
+
+	waitFor("ready")
+	cmd.Process.Signal(syscall.SIGINT)
+	waitFor("draining")
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	// the default handling is restored just after the context is
+	// cancelled, so a signal sent in between is still caught
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		cmd.Process.Signal(syscall.SIGINT)
+		select {
+		case err := <-exited:
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) || exitErr.Sys().(syscall.WaitStatus).Signal() != syscall.SIGINT {
+				t.Errorf("child exited with %v, wanted it killed by SIGINT", err)
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	cmd.Process.Kill()
+	t.Errorf("second signal did not kill the child")
+}
@@ -0,0 +1,67 @@
+// Package startup names the phases the binaries go through before serving and
+// maps a failure in each of them to a distinct process exit code.
+package startup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Phase is a step of the startup sequence.
+type Phase struct {
+	Name     string
+	ExitCode int
+}
+
+var (
+	Config     = Phase{"load configuration", 2}
+	Telemetry  = Phase{"connect telemetry", 3}
+	VaultLogin = Phase{"log in to Vault", 4}
+	IssueCert  = Phase{"issue certificate", 5}
+	BuildTLS   = Phase{"build TLS configuration", 6}
+	FetchJWKS  = Phase{"fetch JWKS", 7}
+	Listen     = Phase{"listen", 8}
+	FetchToken = Phase{"fetch access token", 9}
+	Dial       = Phase{"dial server", 10}
+	Record     = Phase{"open recording", 11}
+)
+
+// Error is returned when a startup phase fails.
+type Error struct {
+	Phase Phase
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("failed to %s: %s", e.Phase.Name, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap attributes err to the phase. It returns nil if err is nil.
+func (p Phase) Wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Phase: p, Err: err}
+}
+
+// ExitCode returns the exit code for err, which is 1 unless err was produced
+// by a startup phase.
+func ExitCode(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Phase.ExitCode
+	}
+	return 1
+}
+
+// Exit reports err through logf and terminates the process with the exit
+// code of the phase that failed.
+func Exit(logf func(format string, args ...interface{}), err error) {
+	logf("%s", err)
+	os.Exit(ExitCode(err))
+}
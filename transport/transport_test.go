@@ -0,0 +1,49 @@
+package transport
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jamiewhitney/grpc-go-vault/config"
+	pb "github.com/jamiewhitney/grpc-go-vault/hello/v1"
+	"github.com/jamiewhitney/grpc-go-vault/internal/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerOptions(t *testing.T) {
+	// hang holds calls for names starting with "hang" until the client
+	// gives up or the connection is closed.
+	hang := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if strings.HasPrefix(req.(*pb.HelloRequest).GetName(), "hang") {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return handler(ctx, req)
+	}
+
+	tests := []struct {
+		name string
+		cfg  config.Transport
+		sent string
+		want codes.Code
+	}{
+		{"defaults", config.Transport{}, strings.Repeat("a", 1<<20), codes.OK},
+		{"request too large", config.Transport{MaxRecvMsgSize: 1024}, strings.Repeat("a", 2048), codes.ResourceExhausted},
+		{"request within limit", config.Transport{MaxRecvMsgSize: 1024}, "world", codes.OK},
+		{"response too large", config.Transport{MaxSendMsgSize: 8}, "world", codes.ResourceExhausted},
+		{"connection too old", config.Transport{MaxConnectionAge: 50 * time.Millisecond, MaxConnectionAgeGrace: 50 * time.Millisecond}, "hang", codes.Unavailable},
+	}
+	for _, tt := range tests {
+		c := testutil.DialHello(t, append(ServerOptions(tt.cfg), grpc.UnaryInterceptor(hang))...)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := c.SayHello(ctx, &pb.HelloRequest{Name: tt.sent})
+		cancel()
+		if got := status.Code(err); got != tt.want {
+			t.Errorf("%s: SayHello() got code %s, wanted %s: %v", tt.name, got, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Package users serves the user API from memory. Users do not survive a
+// restart and are not shared between server pods.
+package users
+
+import (
+	"context"
+	"encoding/base64"
+	"sort"
+	"sync"
+
+	pb "github.com/jamiewhitney/grpc-go-vault/hello/v1"
+	"github.com/jamiewhitney/grpc-go-vault/middleware"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// defaultPageSize is the number of users listed when a request sets none.
+const defaultPageSize = 50
+
+// Server implements CreateUserService, keeping users in memory.
+type Server struct {
+	pb.UnimplementedCreateUserServiceServer
+
+	mu    sync.Mutex
+	users map[string]*pb.User
+}
+
+// NewServer creates a Server with no users.
+func NewServer() *Server {
+	return &Server{users: make(map[string]*pb.User)}
+}
+
+// CreateUser adds a user, failing with codes.AlreadyExists if the id is
+// taken.
+func (s *Server) CreateUser(ctx context.Context, in *pb.CreateUserRequest) (*pb.CreateUserResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[in.GetId()]; ok {
+		return nil, middleware.Status(codes.AlreadyExists, "user already exists", middleware.ReasonUserExists, map[string]string{"id": in.GetId()}).Err()
+	}
+	s.users[in.GetId()] = &pb.User{
+		Id:         in.GetId(),
+		Name:       in.GetName(),
+		CreateTime: timestamppb.Now(),
+	}
+	return &pb.CreateUserResponse{Id: in.GetId()}, nil
+}
+
+// GetUser returns a user, failing with codes.NotFound if there is none with
+// the id.
+func (s *Server) GetUser(ctx context.Context, in *pb.GetUserRequest) (*pb.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[in.GetId()]
+	if !ok {
+		return nil, middleware.Status(codes.NotFound, "user not found", middleware.ReasonUserNotFound, map[string]string{"id": in.GetId()}).Err()
+	}
+	return proto.Clone(user).(*pb.User), nil
+}
+
+// ListUsers returns a page of users ordered by id.
+func (s *Server) ListUsers(ctx context.Context, in *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
+	after, err := base64.RawURLEncoding.DecodeString(in.GetPageToken())
+	if err != nil {
+		return nil, middleware.Status(codes.InvalidArgument, "invalid page token", middleware.ReasonInvalidRequest, nil).Err()
+	}
+	size := int(in.GetPageSize())
+	if size == 0 {
+		size = defaultPageSize
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.users))
+	for id := range s.users {
+		if id > string(after) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	resp := &pb.ListUsersResponse{}
+	if len(ids) > size {
+		ids = ids[:size]
+		resp.NextPageToken = base64.RawURLEncoding.EncodeToString([]byte(ids[size-1]))
+	}
+	for _, id := range ids {
+		resp.Users = append(resp.Users, proto.Clone(s.users[id]).(*pb.User))
+	}
+	return resp, nil
+}
@@ -0,0 +1,66 @@
+package users
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	pb "github.com/jamiewhitney/grpc-go-vault/hello/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	s := NewServer()
+
+	for _, id := range []string{"carol", "alice", "bob"} {
+		if _, err := s.CreateUser(ctx, &pb.CreateUserRequest{Id: id, Name: id}); err != nil {
+			t.Fatalf("CreateUser(%s) got unexpected error: %v", id, err)
+		}
+	}
+	if _, err := s.CreateUser(ctx, &pb.CreateUserRequest{Id: "bob", Name: "Bob"}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("CreateUser(bob) again got error %v, wanted code %s", err, codes.AlreadyExists)
+	}
+
+	user, err := s.GetUser(ctx, &pb.GetUserRequest{Id: "alice"})
+	if err != nil || user.GetName() != "alice" || user.GetCreateTime() == nil {
+		t.Errorf("GetUser(alice) got %v, %v", user, err)
+	}
+	if _, err := s.GetUser(ctx, &pb.GetUserRequest{Id: "dave"}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetUser(dave) got error %v, wanted code %s", err, codes.NotFound)
+	}
+
+	tests := []struct {
+		pageSize  int32
+		wantPages [][]string
+	}{
+		{0, [][]string{{"alice", "bob", "carol"}}},
+		{2, [][]string{{"alice", "bob"}, {"carol"}}},
+		{3, [][]string{{"alice", "bob", "carol"}}},
+	}
+
+	for _, tt := range tests {
+		var pages [][]string
+		req := &pb.ListUsersRequest{PageSize: tt.pageSize}
+		for {
+			resp, err := s.ListUsers(ctx, req)
+			if err != nil {
+				t.Fatalf("ListUsers() got unexpected error: %v", err)
+			}
+			var ids []string
+			for _, u := range resp.GetUsers() {
+				ids = append(ids, u.GetId())
+			}
+			pages = append(pages, ids)
+			if resp.GetNextPageToken() == "" {
+				break
+			}
+			req.PageToken = resp.GetNextPageToken()
+		}
+
+		if !reflect.DeepEqual(pages, tt.wantPages) {
+			t.Errorf("ListUsers() with page size %d got %v, wanted %v", tt.pageSize, pages, tt.wantPages)
+		}
+	}
+}
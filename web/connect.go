@@ -0,0 +1,306 @@
+package web
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// defaultMaxConnectBody bounds the size of Connect request bodies read into
+// memory when no limit is configured, matching gRPC's default for received
+// messages.
+const defaultMaxConnectBody = 4 << 20
+
+const (
+	connectProto = "application/proto"
+	connectJSON  = "application/json"
+)
+
+// isConnect reports whether r is a Connect unary request.
+func isConnect(r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == connectProto || mediaType == connectJSON
+}
+
+// serveConnect translates a Connect unary request into a gRPC request, hands
+// it to s and translates the response back. Bodies over maxBody bytes are
+// rejected.
+func serveConnect(s *grpc.Server, maxBody int64, w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if enc := r.Header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		writeConnectError(w, nil, codes.Unimplemented, fmt.Sprintf("unsupported compression %q", enc), nil)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+	if err != nil {
+		writeConnectError(w, nil, codes.ResourceExhausted, "request too large", nil)
+		return
+	}
+
+	var input, output protoreflect.MessageType
+	if mediaType == connectJSON {
+		input, output, err = methodTypes(r.URL.Path)
+		if err != nil {
+			writeConnectError(w, nil, codes.Unimplemented, err.Error(), nil)
+			return
+		}
+		msg := input.New().Interface()
+		if err := protojson.Unmarshal(body, msg); err != nil {
+			writeConnectError(w, nil, codes.InvalidArgument, fmt.Sprintf("invalid JSON request: %s", err), nil)
+			return
+		}
+		if body, err = proto.Marshal(msg); err != nil {
+			writeConnectError(w, nil, codes.Internal, err.Error(), nil)
+			return
+		}
+	}
+
+	req := r.Clone(r.Context())
+	req.ProtoMajor, req.ProtoMinor, req.Proto = 2, 0, "HTTP/2.0"
+	req.Header.Del("Content-Length")
+	req.Header.Del("Connect-Protocol-Version")
+	req.Header.Del("Connect-Timeout-Ms")
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	if ms := r.Header.Get("Connect-Timeout-Ms"); ms != "" {
+		req.Header.Set("Grpc-Timeout", ms+"m")
+	}
+	req.Body = io.NopCloser(bytes.NewReader(frame(body)))
+	req.ContentLength = int64(5 + len(body))
+
+	rec := &recorder{header: make(http.Header)}
+	s.ServeHTTP(rec, req)
+
+	header, trailer := splitHeaders(rec.header)
+	code, msg, details := grpcStatus(rec.header)
+	if code != codes.OK {
+		writeConnectError(w, mergeTrailers(header, trailer), code, msg, details)
+		return
+	}
+
+	payload, err := unframe(rec.body.Bytes())
+	if err != nil {
+		writeConnectError(w, nil, codes.Internal, err.Error(), nil)
+		return
+	}
+	if mediaType == connectJSON {
+		msg := output.New().Interface()
+		if err := proto.Unmarshal(payload, msg); err != nil {
+			writeConnectError(w, nil, codes.Internal, err.Error(), nil)
+			return
+		}
+		if payload, err = protojson.Marshal(msg); err != nil {
+			writeConnectError(w, nil, codes.Internal, err.Error(), nil)
+			return
+		}
+	}
+
+	for k, vv := range mergeTrailers(header, trailer) {
+		w.Header()[k] = vv
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(payload)
+}
+
+// methodTypes looks up the request and response types of the method at path,
+// which has the form /package.Service/Method.
+func methodTypes(path string) (protoreflect.MessageType, protoreflect.MessageType, error) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) != 2 {
+		return nil, nil, fmt.Errorf("malformed method %q", path)
+	}
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(parts[0]))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unknown service %q", parts[0])
+	}
+	service, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown service %q", parts[0])
+	}
+	method := service.Methods().ByName(protoreflect.Name(parts[1]))
+	if method == nil {
+		return nil, nil, fmt.Errorf("unknown method %q", path)
+	}
+
+	input, err := protoregistry.GlobalTypes.FindMessageByName(method.Input().FullName())
+	if err != nil {
+		return nil, nil, err
+	}
+	output, err := protoregistry.GlobalTypes.FindMessageByName(method.Output().FullName())
+	if err != nil {
+		return nil, nil, err
+	}
+	return input, output, nil
+}
+
+// recorder buffers the gRPC response so it can be rewritten for Connect.
+type recorder struct {
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header         { return r.header }
+func (r *recorder) Write(b []byte) (int, error) { return r.body.Write(b) }
+func (r *recorder) WriteHeader(int)             {}
+func (r *recorder) Flush()                      {}
+
+// frame adds the gRPC length prefix to an uncompressed message.
+func frame(msg []byte) []byte {
+	b := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(b[1:5], uint32(len(msg)))
+	copy(b[5:], msg)
+	return b
+}
+
+// unframe returns the single message in a unary gRPC response body.
+func unframe(body []byte) ([]byte, error) {
+	if len(body) < 5 {
+		return nil, fmt.Errorf("missing response message")
+	}
+	if body[0] != 0 {
+		return nil, fmt.Errorf("unexpected compressed response message")
+	}
+	n := binary.BigEndian.Uint32(body[1:5])
+	if uint32(len(body)-5) < n {
+		return nil, fmt.Errorf("truncated response message")
+	}
+	return body[5 : 5+n], nil
+}
+
+// splitHeaders separates application metadata sent as headers from that sent
+// as trailers, dropping gRPC protocol headers.
+func splitHeaders(h http.Header) (header, trailer http.Header) {
+	header, trailer = make(http.Header), make(http.Header)
+	for k, vv := range h {
+		switch {
+		case strings.HasPrefix(k, http.TrailerPrefix):
+			trailer[http.CanonicalHeaderKey(strings.TrimPrefix(k, http.TrailerPrefix))] = vv
+		case strings.HasPrefix(k, "Grpc-"), k == "Content-Type", k == "Trailer":
+		default:
+			header[k] = vv
+		}
+	}
+	return header, trailer
+}
+
+// mergeTrailers folds trailers into headers with the "Trailer-" prefix
+// Connect uses for unary responses.
+func mergeTrailers(header, trailer http.Header) http.Header {
+	for k, vv := range trailer {
+		header["Trailer-"+k] = vv
+	}
+	return header
+}
+
+func grpcStatus(h http.Header) (codes.Code, string, *spb.Status) {
+	code, err := strconv.Atoi(h.Get("Grpc-Status"))
+	if err != nil {
+		return codes.Internal, "missing gRPC status", nil
+	}
+	msg, err := url.PathUnescape(h.Get("Grpc-Message"))
+	if err != nil {
+		msg = h.Get("Grpc-Message")
+	}
+
+	var details *spb.Status
+	if bin := h.Get("Grpc-Status-Details-Bin"); bin != "" {
+		if b, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(bin, "=")); err == nil {
+			details = &spb.Status{}
+			if proto.Unmarshal(b, details) != nil {
+				details = nil
+			}
+		}
+	}
+	return codes.Code(code), msg, details
+}
+
+type connectError struct {
+	Code    string          `json:"code"`
+	Message string          `json:"message,omitempty"`
+	Details []connectDetail `json:"details,omitempty"`
+}
+
+type connectDetail struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+func writeConnectError(w http.ResponseWriter, header http.Header, code codes.Code, msg string, st *spb.Status) {
+	for k, vv := range header {
+		w.Header()[k] = vv
+	}
+
+	body := connectError{Code: connectCodes[code], Message: msg}
+	if body.Code == "" {
+		body.Code = connectCodes[codes.Unknown]
+	}
+	for _, detail := range st.GetDetails() {
+		body.Details = append(body.Details, connectDetail{
+			Type:  strings.TrimPrefix(detail.GetTypeUrl(), "type.googleapis.com/"),
+			Value: base64.RawStdEncoding.EncodeToString(detail.GetValue()),
+		})
+	}
+
+	w.Header().Set("Content-Type", connectJSON)
+	w.WriteHeader(connectHTTPStatus[code])
+	json.NewEncoder(w).Encode(body)
+}
+
+var connectCodes = map[codes.Code]string{
+	codes.Canceled:           "canceled",
+	codes.Unknown:            "unknown",
+	codes.InvalidArgument:    "invalid_argument",
+	codes.DeadlineExceeded:   "deadline_exceeded",
+	codes.NotFound:           "not_found",
+	codes.AlreadyExists:      "already_exists",
+	codes.PermissionDenied:   "permission_denied",
+	codes.ResourceExhausted:  "resource_exhausted",
+	codes.FailedPrecondition: "failed_precondition",
+	codes.Aborted:            "aborted",
+	codes.OutOfRange:         "out_of_range",
+	codes.Unimplemented:      "unimplemented",
+	codes.Internal:           "internal",
+	codes.Unavailable:        "unavailable",
+	codes.DataLoss:           "data_loss",
+	codes.Unauthenticated:    "unauthenticated",
+}
+
+var connectHTTPStatus = map[codes.Code]int{
+	codes.Canceled:           499,
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusBadRequest,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DataLoss:           http.StatusInternalServerError,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+}
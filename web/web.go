@@ -0,0 +1,90 @@
+// Package web serves native gRPC, gRPC-Web and the Connect protocol from one
+// grpc.Server over a single HTTP listener, so that every protocol goes
+// through the same interceptors, including the authorizer.
+package web
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"github.com/jamiewhitney/grpc-go-vault/config"
+	"github.com/jamiewhitney/grpc-go-vault/middleware"
+	"github.com/rs/cors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// NewHandler returns a handler dispatching each request to s according to
+// its protocol. Native gRPC callers must present a verified client
+// certificate; browser protocols rely on bearer tokens alone. Connect request
+// bodies are held to maxRecvMsgSize, the limit s applies to messages, or to
+// gRPC's default if it is 0.
+func NewHandler(s *grpc.Server, cfg config.Web, maxRecvMsgSize int) http.Handler {
+	grpcWeb := grpcweb.WrapServer(s)
+	maxConnectBody := int64(maxRecvMsgSize)
+	if maxConnectBody <= 0 {
+		maxConnectBody = defaultMaxConnectBody
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case grpcWeb.IsGrpcWebRequest(r):
+			grpcWeb.HandleGrpcWebRequest(w, r)
+		case isGRPC(r):
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+				writeGRPCStatus(w, middleware.Status(codes.Unauthenticated, "client certificate required", middleware.ReasonCertificateRequired, nil))
+				return
+			}
+			s.ServeHTTP(w, r)
+		case isConnect(r):
+			serveConnect(s, maxConnectBody, w, r)
+		default:
+			http.Error(w, "unsupported protocol", http.StatusUnsupportedMediaType)
+		}
+	})
+
+	if len(cfg.AllowedOrigins) == 0 {
+		return handler
+	}
+	return cors.New(cors.Options{
+		AllowedOrigins: cfg.AllowedOrigins,
+		AllowedMethods: []string{http.MethodPost},
+		AllowedHeaders: []string{
+			"Authorization",
+			"Content-Type",
+			"Connect-Protocol-Version",
+			"Connect-Timeout-Ms",
+			"Grpc-Timeout",
+			"X-Grpc-Web",
+			"X-User-Agent",
+			"X-Request-Id",
+		},
+		ExposedHeaders: []string{
+			"Grpc-Status",
+			"Grpc-Message",
+			"Grpc-Status-Details-Bin",
+			"X-Request-Id",
+		},
+	}).Handler(handler)
+}
+
+func isGRPC(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// writeGRPCStatus ends a native gRPC call with a trailers-only response.
+func writeGRPCStatus(w http.ResponseWriter, st *status.Status) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(int(st.Code())))
+	w.Header().Set("Grpc-Message", url.PathEscape(st.Message()))
+	if details, err := proto.Marshal(st.Proto()); err == nil && len(st.Details()) > 0 {
+		w.Header().Set("Grpc-Status-Details-Bin", base64.RawStdEncoding.EncodeToString(details))
+	}
+	w.WriteHeader(http.StatusOK)
+}
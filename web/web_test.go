@@ -0,0 +1,187 @@
+package web
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jamiewhitney/grpc-go-vault/config"
+	pb "github.com/jamiewhitney/grpc-go-vault/hello/v1"
+	"github.com/jamiewhitney/grpc-go-vault/internal/testutil"
+	"github.com/jamiewhitney/grpc-go-vault/middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// newTestHandler serves HelloService behind the server's authorizer.
+func newTestHandler(t *testing.T, maxRecvMsgSize int) http.Handler {
+	t.Helper()
+
+	s := grpc.NewServer(grpc.UnaryInterceptor(middleware.UnaryAuthorizer(testutil.Authorizer())))
+	pb.RegisterHelloServiceServer(s, &testutil.HelloServer{})
+	t.Cleanup(s.Stop)
+	return NewHandler(s, config.Web{Enabled: true}, maxRecvMsgSize)
+}
+
+func TestConnect(t *testing.T) {
+	handler := newTestHandler(t, 0)
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+		wantBody   string
+	}{
+		{"authorized", testutil.Token(t, testutil.Subject), http.StatusOK, `{"greeting":"Hello world"}`},
+		{"unauthenticated", "", http.StatusUnauthorized, `{"code":"unauthenticated","message":"missing bearer token","details":[{"type":"google.rpc.ErrorInfo","value":"Cg1JTlZBTElEX1RPS0VOEiVncnBjLWdvLXZhdWx0LmphbWlld2hpdG5leS5naXRodWIuY29t"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/hello.v1.HelloService/SayHello", strings.NewReader(`{"name":"world"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Connect-Protocol-Version", "1")
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Connect call got status %d, wanted %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := compactJSON(t, rec.Body.Bytes()); got != tt.wantBody {
+				t.Errorf("Connect call got body %s, wanted %s", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestConnectBodyLimit(t *testing.T) {
+	tests := []struct {
+		maxRecvMsgSize int
+		name           string
+		wantStatus     int
+	}{
+		{0, strings.Repeat("a", 1<<20), http.StatusOK},
+		{1024, "world", http.StatusOK},
+		{1024, strings.Repeat("a", 2048), http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		handler := newTestHandler(t, tt.maxRecvMsgSize)
+		req := httptest.NewRequest(http.MethodPost, "/hello.v1.HelloService/SayHello", strings.NewReader(`{"name":"`+tt.name+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", testutil.Token(t, testutil.Subject))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.wantStatus {
+			t.Errorf("Connect call of %d bytes with limit %d got status %d, wanted %d", len(tt.name), tt.maxRecvMsgSize, rec.Code, tt.wantStatus)
+		}
+	}
+}
+
+func TestConnectProto(t *testing.T) {
+	handler := newTestHandler(t, 0)
+
+	body, err := proto.Marshal(&pb.HelloRequest{Name: "world"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/hello.v1.HelloService/SayHello", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/proto")
+	req.Header.Set("Authorization", testutil.Token(t, testutil.Subject))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Connect call got status %d: %s", rec.Code, rec.Body)
+	}
+	var resp pb.HelloResponse
+	if err := proto.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Hello world"; resp.GetGreeting() != want {
+		t.Errorf("Connect call got greeting %q, wanted %q", resp.GetGreeting(), want)
+	}
+}
+
+func TestGRPCWeb(t *testing.T) {
+	handler := newTestHandler(t, 0)
+
+	body, err := proto.Marshal(&pb.HelloRequest{Name: "world"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/hello.v1.HelloService/SayHello", bytes.NewReader(frame(body)))
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	req.Header.Set("X-Grpc-Web", "1")
+	req.Header.Set("Authorization", testutil.Token(t, testutil.Subject))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("gRPC-Web call got status %d: %s", rec.Code, rec.Body)
+	}
+	msg, err := unframe(rec.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp pb.HelloResponse
+	if err := proto.Unmarshal(msg, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Hello world"; resp.GetGreeting() != want {
+		t.Errorf("gRPC-Web call got greeting %q, wanted %q", resp.GetGreeting(), want)
+	}
+
+	// The status follows the message in a trailer frame.
+	trailers := rec.Body.Bytes()[5+binary.BigEndian.Uint32(rec.Body.Bytes()[1:5]):]
+	if len(trailers) < 5 || trailers[0]&0x80 == 0 || !strings.Contains(strings.ToLower(string(trailers[5:])), "grpc-status: 0") {
+		t.Errorf("gRPC-Web call got trailers %q, wanted grpc-status 0", trailers)
+	}
+}
+
+func TestNativeGRPCRequiresClientCert(t *testing.T) {
+	handler := newTestHandler(t, 0)
+
+	body, err := proto.Marshal(&pb.HelloRequest{Name: "world"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/hello.v1.HelloService/SayHello", bytes.NewReader(frame(body)))
+	req.ProtoMajor, req.ProtoMinor = 2, 0
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Authorization", testutil.Token(t, testutil.Subject))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got, want := rec.Header().Get("Grpc-Status"), "16"; got != want {
+		t.Errorf("native gRPC call without certificate got grpc-status %q, wanted %q", got, want)
+	}
+}
+
+func TestUnsupportedProtocol(t *testing.T) {
+	handler := newTestHandler(t, 0)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("GET / got status %d, wanted %d", rec.Code, http.StatusUnsupportedMediaType)
+	}
+}
+
+func compactJSON(t *testing.T, b []byte) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		t.Fatalf("invalid JSON %s: %v", b, err)
+	}
+	return buf.String()
+}